@@ -45,6 +45,19 @@ func NewReadRegisterCommand(register uint32) *Command {
 	)
 }
 
+// NewWriteRegisterCommand sets the bits in mask of register to value, then waits delayMicroseconds
+func NewWriteRegisterCommand(register uint32, value uint32, mask uint32, delayMicroseconds uint32) *Command {
+	payload := Uint32ToBytes(register)
+	payload = append(payload, Uint32ToBytes(value)...)
+	payload = append(payload, Uint32ToBytes(mask)...)
+	payload = append(payload, Uint32ToBytes(delayMicroseconds)...)
+
+	return NewCommand(
+		OpcodeWriteReg,
+		payload,
+	)
+}
+
 func NewSyncCommand() *Command {
 	payload := []byte{0x07, 0x07, 0x12, 0x20}
 	payload = append(payload, bytes.Repeat([]byte{0x55}, 32)...)
@@ -69,6 +82,20 @@ func NewReadFlashCommand(offset uint32, size uint32) *Command {
 	)
 }
 
+// NewReadFlashFastCommand starts a streaming flash read (stub only). The stub sends packets of
+// sectorSize bytes and waits for acknowledgement once maxInFlight packets are unacknowledged.
+func NewReadFlashFastCommand(offset uint32, size uint32, sectorSize uint32, maxInFlight uint32) *Command {
+	payload := Uint32ToBytes(offset)
+	payload = append(payload, Uint32ToBytes(size)...)
+	payload = append(payload, Uint32ToBytes(sectorSize)...)
+	payload = append(payload, Uint32ToBytes(maxInFlight)...)
+
+	return NewCommand(
+		OpcodeReadFlashFast,
+		payload,
+	)
+}
+
 func NewChangeBaudrateCommand(newBaudrate uint32, oldBaudrate uint32) *Command {
 	payload := Uint32ToBytes(newBaudrate)
 	payload = append(payload, Uint32ToBytes(oldBaudrate)...)
@@ -134,13 +161,83 @@ func NewFlashDataDeflCommand(data []byte, sequence uint32) *Command {
 	return cmd
 }
 
+// NewFlashEndCommand finishes a FLASH_BEGIN sequence and reboots if reboot is set. Otherwise the
+// stub keeps running, but the ROM loader leaves download mode either way and runs the user code.
 func NewFlashEndCommand(reboot bool) *Command {
-	param := uint32(0)
-	if reboot {
-		param = 1
-	}
 	return NewCommand(
 		OpcodeFlashEnd,
-		Uint32ToBytes(param),
+		flashEndPayload(reboot),
+	)
+}
+
+// NewFlashDeflEndCommand finishes a FLASH_DEFL_BEGIN sequence, see NewFlashEndCommand.
+func NewFlashDeflEndCommand(reboot bool) *Command {
+	return NewCommand(
+		OpcodeFlashDeflEnd,
+		flashEndPayload(reboot),
 	)
 }
+
+func flashEndPayload(reboot bool) []byte {
+	// 0 reboots, 1 keeps the stub running or makes the ROM loader run the user code
+	runUserCode := uint32(1)
+	if reboot {
+		runUserCode = 0
+	}
+	return Uint32ToBytes(runUserCode)
+}
+
+func NewSpiFlashMD5Command(offset uint32, size uint32) *Command {
+	payload := Uint32ToBytes(offset)
+	payload = append(payload, Uint32ToBytes(size)...)
+	payload = append(payload, Uint32ToBytes(0)...)
+	payload = append(payload, Uint32ToBytes(0)...)
+
+	return NewCommand(OpcodeSpiFlashMd5, payload)
+}
+
+func NewMemBeginCommand(size uint32, numBlocks uint32, blockSize uint32, offset uint32) *Command {
+	payload := Uint32ToBytes(size)
+	payload = append(payload, Uint32ToBytes(numBlocks)...)
+	payload = append(payload, Uint32ToBytes(blockSize)...)
+	payload = append(payload, Uint32ToBytes(offset)...)
+
+	return NewCommand(OpcodeMemBegin, payload)
+}
+
+func NewMemDataCommand(data []byte, sequence uint32) *Command {
+	checksum := calculateChecksum(data)
+	payload := Uint32ToBytes(uint32(len(data)))
+	payload = append(payload, Uint32ToBytes(sequence)...)
+	payload = append(payload, Uint32ToBytes(0)...)
+	payload = append(payload, Uint32ToBytes(0)...)
+	payload = append(payload, data...)
+
+	cmd := NewCommand(OpcodeMemData, payload)
+	cmd.Checksum = checksum
+
+	return cmd
+}
+
+// NewMemEndCommand finishes a RAM upload. The bootloader jumps to entrypoint unless it is zero.
+func NewMemEndCommand(entrypoint uint32) *Command {
+	noEntry := uint32(0)
+	if entrypoint == 0 {
+		noEntry = 1
+	}
+	payload := Uint32ToBytes(noEntry)
+	payload = append(payload, Uint32ToBytes(entrypoint)...)
+
+	return NewCommand(OpcodeMemEnd, payload)
+}
+
+func NewEraseFlashCommand() *Command {
+	return NewCommand(OpcodeEraseFlash, []byte{})
+}
+
+func NewEraseRegionCommand(offset uint32, size uint32) *Command {
+	payload := Uint32ToBytes(offset)
+	payload = append(payload, Uint32ToBytes(size)...)
+
+	return NewCommand(OpcodeEraseRegion, payload)
+}
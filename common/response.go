@@ -5,8 +5,18 @@ import (
 )
 
 const (
-	minResponseSize    int = 10
+	responseHeaderSize int = 8
 	responseStatusSize int = 2
+
+	// StatusLengthROM is the number of status bytes the ESP32 ROM bootloader appends to each response
+	StatusLengthROM int = 4
+	// StatusLengthROMESP8266 is the number of status bytes the ESP8266 ROM bootloader appends to each response
+	StatusLengthROMESP8266 int = 2
+	// StatusLengthStub is the number of status bytes the flasher stub appends to each response
+	StatusLengthStub int = 2
+	// StatusLengthUnknown takes everything after the header as status, which fits the responses
+	// to SYNC and READ_REG of every loader
+	StatusLengthUnknown int = 0
 )
 
 type ResponseStatus struct {
@@ -37,20 +47,29 @@ func NewResponseStatus(data []byte) (*ResponseStatus, error) {
 	}, nil
 }
 
-func NewResponse(data []byte) (*Response, error) {
-	if len(data) < minResponseSize {
-		return nil, fmt.Errorf("Invalid response length. Received %d bytes, expected at least %d bytes", len(data), minResponseSize)
+// NewResponse parses a response whose data is followed by statusLength status bytes,
+// see StatusLengthROM and StatusLengthStub
+func NewResponse(data []byte, statusLength int) (*Response, error) {
+	if statusLength == StatusLengthUnknown {
+		statusLength = len(data) - responseHeaderSize
+		if statusLength < responseStatusSize {
+			statusLength = responseStatusSize
+		}
+	}
+	if len(data) < responseHeaderSize+statusLength {
+		return nil, fmt.Errorf("Invalid response length. Received %d bytes, expected at least %d bytes", len(data), responseHeaderSize+statusLength)
 	}
+	statusOffset := len(data) - statusLength
 	response := &Response{
 		Direction: Direction(data[0]),
 		Opcode:    Opcode(data[1]),
 		Size:      BytesToUint16(data[2:4]),
-		Data:      data[8 : len(data)-1],
+		Data:      data[responseHeaderSize:statusOffset],
 	}
 	for i := 0; i < 4; i++ {
 		response.Value[i] = data[4+i]
 	}
-	status, err := NewResponseStatus(data[len(data)-2 : len(data)])
+	status, err := NewResponseStatus(data[statusOffset : statusOffset+responseStatusSize])
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,32 @@
+package serial
+
+import (
+	"golang.org/x/sys/unix"
+	"testing"
+)
+
+func TestArbitraryBaudrate(t *testing.T) {
+	master, path := openPty(t)
+	defer master.Close()
+
+	port, err := OpenPort(NewConfig(path, 1843200))
+	if err != nil {
+		t.Fatalf("OpenPort errored with: %v", err)
+	}
+	defer port.Close()
+	for _, baudrate := range []uint32{1843200, 115200, 74880} {
+		if err = port.SetBaudrate(baudrate); err != nil {
+			t.Fatalf("SetBaudrate(%d) errored with: %v", baudrate, err)
+		}
+		termios, err := unix.IoctlGetTermios(int(port.file.Fd()), unix.TCGETS2)
+		if err != nil {
+			t.Fatalf("TCGETS2 errored with: %v", err)
+		}
+		if termios.Ospeed != baudrate || termios.Ispeed != baudrate {
+			t.Errorf("Expected %d baud, the port is at %d/%d", baudrate, termios.Ispeed, termios.Ospeed)
+		}
+	}
+	if err = port.SetBaudrate(0); err == nil {
+		t.Errorf("Expected baudrate 0 to be rejected")
+	}
+}
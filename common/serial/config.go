@@ -20,13 +20,26 @@ const (
 	ParitySpace
 )
 
+type FlowControl byte
+
+const (
+	FlowControlNone FlowControl = iota
+	// FlowControlRTSCTS lets the driver pause on CTS, which conflicts with RTS driving EN of an ESP
+	FlowControlRTSCTS
+	FlowControlXONXOFF
+)
+
 type Config struct {
-	PortPath    string
-	BaudRate    uint32
+	PortPath string
+	BaudRate uint32
+	// ReadTimeout is how long Read waits for data without read deadline, zero waits forever
 	ReadTimeout time.Duration
 	DataBits    byte
 	StopBits    StopBits
 	Parity      Parity
+	FlowControl FlowControl
+	// LockTimeout is how long OpenPort waits for another process to release the port
+	LockTimeout time.Duration
 }
 
 func NewConfig(portPath string, baudrate uint32) *Config {
@@ -0,0 +1,75 @@
+package serial
+
+import (
+	"testing"
+)
+
+var lineSettings = []Config{
+	{BaudRate: 115200, DataBits: 8, StopBits: StopBitsOne, Parity: ParityNone, FlowControl: FlowControlNone},
+	{BaudRate: 9600, DataBits: 7, StopBits: StopBitsTwo, Parity: ParityOdd, FlowControl: FlowControlRTSCTS},
+	{BaudRate: 74880, DataBits: 8, StopBits: StopBitsOne, Parity: ParityEven, FlowControl: FlowControlXONXOFF},
+	{BaudRate: 115200, DataBits: 6, StopBits: StopBitsOne, Parity: ParityMark, FlowControl: FlowControlNone},
+	{BaudRate: 115200, DataBits: 8, StopBits: StopBitsOne, Parity: ParitySpace, FlowControl: FlowControlNone},
+	{BaudRate: 1200, DataBits: 5, StopBits: StopBitsOneHalf, Parity: ParityNone, FlowControl: FlowControlNone},
+}
+
+func withLineSettings(path string, settings Config) *Config {
+	config := NewConfig(path, settings.BaudRate)
+	config.DataBits = settings.DataBits
+	config.StopBits = settings.StopBits
+	config.Parity = settings.Parity
+	config.FlowControl = settings.FlowControl
+	return config
+}
+
+func TestTermiosRoundTrip(t *testing.T) {
+	for _, expected := range lineSettings {
+		config := withLineSettings("", expected)
+		termios, err := config.toTermios()
+		if err != nil {
+			t.Fatalf("toTermios(%+v) errored with: %v", expected, err)
+		}
+		actual := &Config{}
+		actual.fromTermios(termios)
+		if actual.BaudRate != expected.BaudRate || actual.DataBits != expected.DataBits || actual.StopBits != expected.StopBits ||
+			actual.Parity != expected.Parity || actual.FlowControl != expected.FlowControl {
+			t.Errorf("Expected %+v, decoded %+v", expected, *actual)
+		}
+	}
+
+	for _, invalid := range []Config{
+		{BaudRate: 115200, DataBits: 8, StopBits: StopBitsOneHalf},
+		{BaudRate: 115200, DataBits: 5, StopBits: StopBitsTwo},
+		{BaudRate: 115200, DataBits: 8, Parity: 5},
+		{BaudRate: 115200, DataBits: 8, FlowControl: 3},
+	} {
+		if _, err := withLineSettings("", invalid).toTermios(); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	master, path := openPty(t)
+	defer master.Close()
+
+	// the pty driver forces 8 data bits without parity, so only check what it keeps
+	for _, expected := range lineSettings {
+		if expected.DataBits != 8 {
+			continue
+		}
+		port, err := OpenPort(withLineSettings(path, expected))
+		if err != nil {
+			t.Fatalf("OpenPort(%+v) errored with: %v", expected, err)
+		}
+		actual, err := port.ReadConfig()
+		port.Close()
+		if err != nil {
+			t.Fatalf("ReadConfig errored with: %v", err)
+		}
+		if actual.PortPath != path || actual.BaudRate != expected.BaudRate || actual.StopBits != expected.StopBits ||
+			actual.FlowControl != expected.FlowControl {
+			t.Errorf("Expected %+v, read back %+v", expected, *actual)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+// +build linux
+
+package serial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListPorts enumerates the USB serial ports /dev/ttyUSB* and /dev/ttyACM* through sysfs
+func ListPorts() ([]*PortInfo, error) {
+	return listPorts("/sys/class/tty", "/dev")
+}
+
+func listPorts(sysfsTTYDir string, devDir string) ([]*PortInfo, error) {
+	entries, err := ioutil.ReadDir(sysfsTTYDir)
+	if err != nil {
+		return nil, err
+	}
+	byID := readByIDLinks(filepath.Join(devDir, "serial", "by-id"))
+
+	ports := []*PortInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "ttyUSB") && !strings.HasPrefix(name, "ttyACM") {
+			continue
+		}
+		port := &PortInfo{
+			Path: filepath.Join(devDir, name),
+			ByID: byID[name],
+		}
+		// device links to the interface, the attributes are on the USB device above it
+		device, err := filepath.EvalSymlinks(filepath.Join(sysfsTTYDir, name, "device"))
+		if err == nil {
+			readUSBAttributes(port, device)
+		}
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Path < ports[j].Path
+	})
+	return ports, nil
+}
+
+// readUSBAttributes fills in the attributes of the first directory above dir that has an idVendor
+func readUSBAttributes(port *PortInfo, dir string) {
+	for ; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err != nil {
+			continue
+		}
+		port.VendorID = readAttribute(dir, "idVendor")
+		port.ProductID = readAttribute(dir, "idProduct")
+		port.SerialNumber = readAttribute(dir, "serial")
+		port.Manufacturer = readAttribute(dir, "manufacturer")
+		port.Product = readAttribute(dir, "product")
+		return
+	}
+}
+
+func readAttribute(dir string, name string) string {
+	value, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// readByIDLinks maps tty names to the links pointing to them in dir
+func readByIDLinks(dir string) map[string]string {
+	links := map[string]string{}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return links
+	}
+	for _, entry := range entries {
+		link := filepath.Join(dir, entry.Name())
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		links[filepath.Base(target)] = link
+	}
+	return links
+}
@@ -0,0 +1,75 @@
+package serial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAttributes(t *testing.T, dir string, attributes map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range attributes {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func linkDevice(t *testing.T, ttyDir string, name string, device string) {
+	if err := os.MkdirAll(filepath.Join(ttyDir, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(device, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(device, filepath.Join(ttyDir, name, "device")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListPorts(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ttyDir := filepath.Join(root, "class", "tty")
+	devDir := filepath.Join(root, "dev")
+
+	uart := filepath.Join(root, "devices", "usb1", "1-1")
+	writeAttributes(t, uart, map[string]string{"idVendor": "10c4", "idProduct": "ea60", "serial": "0001", "manufacturer": "Silicon Labs", "product": "CP2102"})
+	linkDevice(t, ttyDir, "ttyUSB0", filepath.Join(uart, "1-1:1.0", "ttyUSB0"))
+	jtag := filepath.Join(root, "devices", "usb1", "1-2")
+	writeAttributes(t, jtag, map[string]string{"idVendor": "303a", "idProduct": "1001"})
+	linkDevice(t, ttyDir, "ttyACM0", filepath.Join(jtag, "1-2:1.0"))
+	linkDevice(t, ttyDir, "ttyS0", filepath.Join(root, "devices", "platform", "serial8250"))
+
+	byID := filepath.Join(devDir, "serial", "by-id")
+	if err = os.MkdirAll(byID, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("../../ttyUSB0", filepath.Join(byID, "usb-Silicon_Labs_CP2102_0001-if00-port0")); err != nil {
+		t.Fatal(err)
+	}
+
+	ports, err := listPorts(ttyDir, devDir)
+	if err != nil {
+		t.Fatalf("listPorts errored with: %v", err)
+	}
+	if len(ports) != 2 {
+		t.Fatalf("Expected 2 ports, found %d", len(ports))
+	}
+	acm, usb := ports[0], ports[1]
+	if acm.Path != filepath.Join(devDir, "ttyACM0") || !acm.IsUSBJTAGSerial() || acm.ByID != "" {
+		t.Errorf("Expected the USB-Serial/JTAG controller on ttyACM0, found %s", acm.String())
+	}
+	if usb.VendorID != "10c4" || usb.ProductID != "ea60" || usb.SerialNumber != "0001" || usb.Product != "CP2102" || usb.IsUSBJTAGSerial() {
+		t.Errorf("Unexpected attributes of ttyUSB0: %s", usb.String())
+	}
+	if usb.ByID != filepath.Join(byID, "usb-Silicon_Labs_CP2102_0001-if00-port0") {
+		t.Errorf("Expected the by-id link of ttyUSB0, found '%s'", usb.ByID)
+	}
+}
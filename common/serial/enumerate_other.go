@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package serial
+
+import "fmt"
+
+// ListPorts is only supported on Linux
+func ListPorts() ([]*PortInfo, error) {
+	return nil, fmt.Errorf("Enumerating serial ports is not supported on this platform")
+}
@@ -15,7 +15,11 @@ func (p *Port) ioctl(req uint64, data uintptr) (err error) {
 	return
 }
 
+// setTermSettings applies settings, arbitrary baudrates need TCSETS2 which also sets the speed fields
 func (p *Port) setTermSettings(settings *unix.Termios) error {
+	if settings.Cflag&unix.CBAUD == unix.BOTHER {
+		return p.ioctl(unix.TCSETS2, uintptr(unsafe.Pointer(settings)))
+	}
 	return p.ioctl(unix.TCSETS, uintptr(unsafe.Pointer(settings)))
 }
 
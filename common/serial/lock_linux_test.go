@@ -0,0 +1,69 @@
+package serial
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openPty returns the master side and the path of the slave side of a new pseudo terminal
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("No pseudo terminals: %v", err)
+	}
+	if err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	number, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", number)
+}
+
+func TestOpenPortExclusive(t *testing.T) {
+	master, path := openPty(t)
+	defer master.Close()
+
+	port, err := OpenPort(NewConfig(path, 115200))
+	if err != nil {
+		t.Fatalf("OpenPort errored with: %v", err)
+	}
+	_, err = OpenPort(NewConfig(path, 115200))
+	expected := fmt.Sprintf("Port %s is busy, held by PID %d", path, os.Getpid())
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected '%s', got: %v", expected, err)
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		port.Close()
+	}()
+	config := NewConfig(path, 115200)
+	config.LockTimeout = 5 * time.Second
+	second, err := OpenPort(config)
+	if err != nil {
+		t.Fatalf("Waiting for the lock errored with: %v", err)
+	}
+	second.Close()
+}
+
+func TestLockHolder(t *testing.T) {
+	locks := "1: POSIX  ADVISORY  WRITE 99 00:05:87 0 EOF\n" +
+		"2: FLOCK  ADVISORY  WRITE 1234 00:05:87 0 EOF\n" +
+		"2: -> FLOCK  ADVISORY  WRITE 5678 00:05:87 0 EOF\n" +
+		"3: FLOCK  ADVISORY  WRITE 4321 fd:01:87 0 EOF\n"
+	if pid := lockHolder(strings.NewReader(locks), unix.Mkdev(0, 5), 87); pid != 1234 {
+		t.Errorf("Expected PID 1234, got %d", pid)
+	}
+	if pid := lockHolder(strings.NewReader(locks), unix.Mkdev(0xfd, 1), 87); pid != 4321 {
+		t.Errorf("Expected PID 4321, got %d", pid)
+	}
+	if pid := lockHolder(strings.NewReader(locks), unix.Mkdev(0, 5), 88); pid != 0 {
+		t.Errorf("Expected no PID, got %d", pid)
+	}
+}
@@ -0,0 +1,109 @@
+//go:build !windows
+// +build !windows
+
+package serial
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lockRetryInterval = 100 * time.Millisecond
+
+// errPortBusy is returned by tryOpenExclusive if another process holds the port
+var errPortBusy = errors.New("port busy")
+
+// openExclusive opens the port at path with TIOCEXCL set and an exclusive flock held, so no other
+// process can open it in the meantime. A busy port is retried until lockTimeout has passed.
+func openExclusive(path string, lockTimeout time.Duration) (*os.File, error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := tryOpenExclusive(path)
+		if err != errPortBusy {
+			return file, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, busyError(path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func tryOpenExclusive(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0666)
+	if errors.Is(err, unix.EBUSY) {
+		// TIOCEXCL is set by another process
+		return nil, errPortBusy
+	}
+	if err != nil {
+		return nil, err
+	}
+	// TIOCEXCL keeps out everything but root, the flock also keeps out other instances running as root
+	err = unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		file.Close()
+		return nil, errPortBusy
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to lock %s: %v", path, err)
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), uintptr(unix.TIOCEXCL), 0)
+	if errno != 0 {
+		file.Close()
+		return nil, fmt.Errorf("Failed to get exclusive access to %s: %v", path, errno)
+	}
+	return file, nil
+}
+
+// busyError names the process holding the port, if it can be found in /proc/locks
+func busyError(path string) error {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err == nil {
+		if locks, err := os.Open("/proc/locks"); err == nil {
+			defer locks.Close()
+			if pid := lockHolder(locks, uint64(stat.Dev), uint64(stat.Ino)); pid != 0 {
+				return fmt.Errorf("Port %s is busy, held by PID %d", path, pid)
+			}
+		}
+	}
+	return fmt.Errorf("Port %s is busy, held by another process", path)
+}
+
+// lockHolder returns the PID holding a FLOCK on the inode ino of the file system dev, or 0.
+// Lines of /proc/locks look like "1: FLOCK  ADVISORY  WRITE 1234 00:05:87 0 EOF".
+func lockHolder(locks io.Reader, dev uint64, ino uint64) int {
+	scanner := bufio.NewScanner(locks)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// waiting processes are listed with "->" after the lock they wait for
+		if len(fields) < 6 || fields[1] != "FLOCK" {
+			continue
+		}
+		id := strings.Split(fields[5], ":")
+		if len(id) != 3 {
+			continue
+		}
+		major, errMajor := strconv.ParseUint(id[0], 16, 32)
+		minor, errMinor := strconv.ParseUint(id[1], 16, 32)
+		inode, errInode := strconv.ParseUint(id[2], 10, 64)
+		if errMajor != nil || errMinor != nil || errInode != nil {
+			continue
+		}
+		if uint64(unix.Major(dev)) != major || uint64(unix.Minor(dev)) != minor || inode != ino {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err == nil {
+			return pid
+		}
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package serial
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// VendorIDEspressif is the USB vendor ID of the USB-Serial/JTAG controller of the ESP32-S3 and newer chips
+	VendorIDEspressif = "303a"
+	// ProductIDUSBJTAGSerial is the product ID of the USB-Serial/JTAG controller
+	ProductIDUSBJTAGSerial = "1001"
+)
+
+// PortInfo describes a USB serial port. The USB attributes are empty if unknown.
+type PortInfo struct {
+	Path         string
+	ByID         string `json:",omitempty"`
+	VendorID     string `json:",omitempty"`
+	ProductID    string `json:",omitempty"`
+	SerialNumber string `json:",omitempty"`
+	Manufacturer string `json:",omitempty"`
+	Product      string `json:",omitempty"`
+}
+
+// IsUSBJTAGSerial returns true for the USB-Serial/JTAG controller built into ESP chips
+func (p *PortInfo) IsUSBJTAGSerial() bool {
+	return p.VendorID == VendorIDEspressif && p.ProductID == ProductIDUSBJTAGSerial
+}
+
+func (p *PortInfo) String() string {
+	description := p.Path
+	if p.VendorID != "" {
+		description += fmt.Sprintf(" [%s:%s]", p.VendorID, p.ProductID)
+	}
+	if p.Manufacturer != "" || p.Product != "" {
+		description += " " + strings.TrimSpace(p.Manufacturer+" "+p.Product)
+	}
+	if p.SerialNumber != "" {
+		description += fmt.Sprintf(" (serial %s)", p.SerialNumber)
+	}
+	if p.ByID != "" {
+		description += "\n  " + p.ByID
+	}
+	return description
+}
@@ -0,0 +1,46 @@
+package serial
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadDeadline(t *testing.T) {
+	master, path := openPty(t)
+	defer master.Close()
+
+	port, err := OpenPort(NewConfig(path, 115200))
+	if err != nil {
+		t.Fatalf("OpenPort errored with: %v", err)
+	}
+	defer port.Close()
+	buf := make([]byte, 16)
+
+	// without deadline Read gives up after ReadTimeout
+	if n, err := port.Read(buf); n != 0 || err != nil {
+		t.Errorf("Expected an empty read, got %d bytes and %v", n, err)
+	}
+
+	start := time.Now()
+	port.SetReadDeadline(start.Add(50 * time.Millisecond))
+	_, err = port.Read(buf)
+	elapsed := time.Since(start)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded, got: %v", err)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Expected Read to return after 50ms, took %v", elapsed)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		master.Write([]byte{0xC0})
+	}()
+	port.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := port.Read(buf)
+	if err != nil || n != 1 || buf[0] != 0xC0 {
+		t.Errorf("Expected to read 0xC0, got %d bytes and %v", n, err)
+	}
+}
@@ -25,9 +25,9 @@ func OpenPort(config *Config) (*Port, error) {
 		return nil, err
 	}
 
-	file, err := os.OpenFile(config.PortPath, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0666)
+	file, err := openExclusive(config.PortPath, config.LockTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("os.OpenFile errored with: %v", err)
+		return nil, err
 	}
 
 	port := &Port{
@@ -36,6 +36,7 @@ func OpenPort(config *Config) (*Port, error) {
 	}
 
 	if err = termios.Tcsetattr(uintptr(unsafe.Pointer(file.Fd())), termios.TCSANOW, termiosConfig); err != nil {
+		file.Close()
 		return nil, fmt.Errorf("termios.Tcsetattr errored with: %v", err)
 	}
 
@@ -85,6 +86,11 @@ func (p *Port) SetBaudrate(baudrate uint32) error {
 	// return p.setTermSettings(termiosConfig)
 }
 
+// GetBaudrate returns the configured signalling rate
+func (p *Port) GetBaudrate() uint32 {
+	return p.Config.BaudRate
+}
+
 func (p *Port) Read(b []byte) (int, error) {
 	return p.file.Read(b)
 }
@@ -9,11 +9,10 @@ import (
 	"time"
 )
 
-const maxReadTimeout = 255 * 100 * time.Millisecond
-
 type Port struct {
-	file   *os.File
-	Config *Config
+	file         *os.File
+	Config       *Config
+	readDeadline time.Time
 }
 
 func OpenPort(config *Config) (*Port, error) {
@@ -22,7 +21,7 @@ func OpenPort(config *Config) (*Port, error) {
 		return nil, err
 	}
 
-	file, err := os.OpenFile(config.PortPath, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0666)
+	file, err := openExclusive(config.PortPath, config.LockTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -33,10 +32,12 @@ func OpenPort(config *Config) (*Port, error) {
 	}
 
 	if err = port.setTermSettings(termiosConfig); err != nil {
+		file.Close()
 		return nil, err
 	}
 
 	if err = unix.SetNonblock(int(file.Fd()), false); err != nil {
+		file.Close()
 		return nil, err
 	}
 
@@ -73,18 +74,65 @@ func (p *Port) SetRTS(rts bool) error {
 	return p.setModemBitsStatus(status)
 }
 
+// SetBaudrate changes the signalling rate, rates without B* constant are set through termios2
 func (p *Port) SetBaudrate(baudrate uint32) error {
-	p.Config.BaudRate = baudrate
-	termiosConfig, err := p.Config.toTermios()
+	config := *p.Config
+	config.BaudRate = baudrate
+	termiosConfig, err := config.toTermios()
 	if err != nil {
 		return err
 	}
 
-	return p.setTermSettings(termiosConfig)
+	if err = p.setTermSettings(termiosConfig); err != nil {
+		return err
+	}
+	p.Config.BaudRate = baudrate
+	return nil
+}
+
+// SetReadDeadline makes Read fail with os.ErrDeadlineExceeded once t has passed. With a zero t,
+// Read waits for up to Config.ReadTimeout instead.
+func (p *Port) SetReadDeadline(t time.Time) error {
+	p.readDeadline = t
+	return nil
+}
+
+// GetBaudrate returns the configured signalling rate
+func (p *Port) GetBaudrate() uint32 {
+	return p.Config.BaudRate
 }
 
+// Read polls for data until the read deadline or the read timeout, the driver itself always
+// blocks for at least one byte (VMIN 1, VTIME 0)
 func (p *Port) Read(b []byte) (int, error) {
-	return p.file.Read(b)
+	for {
+		timeout := -1
+		if !p.readDeadline.IsZero() {
+			remaining := time.Until(p.readDeadline)
+			if remaining <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timeout = int((remaining + time.Millisecond - 1) / time.Millisecond)
+		} else if p.Config.ReadTimeout > 0 {
+			timeout = int((p.Config.ReadTimeout + time.Millisecond - 1) / time.Millisecond)
+		}
+
+		fds := []unix.PollFd{{Fd: int32(p.file.Fd()), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, timeout)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			if p.readDeadline.IsZero() {
+				return 0, nil
+			}
+			continue
+		}
+		return p.file.Read(b)
+	}
 }
 
 func (p *Port) Write(b []byte) (int, error) {
@@ -95,6 +143,8 @@ func (p *Port) Flush() error {
 	return p.ioctl(unix.TCFLSH, unix.TCIOFLUSH)
 }
 
+// getBaudrateFlag returns the B* constant of a standard rate or BOTHER for any other rate,
+// which is then taken from the speed fields of termios2
 func getBaudrateFlag(baudrate uint32) (uint32, error) {
 	mapping := map[uint32]uint32{
 		50:      unix.B50,
@@ -128,9 +178,12 @@ func getBaudrateFlag(baudrate uint32) (uint32, error) {
 		3500000: unix.B3500000,
 		4000000: unix.B4000000,
 	}
+	if baudrate == 0 {
+		return 0, fmt.Errorf("Baudrate 0 not supported")
+	}
 	value, found := mapping[baudrate]
 	if !found {
-		return 0, fmt.Errorf("Baudrate %d not supported. Please choose POSIX compliant baudrate.", baudrate)
+		return unix.BOTHER, nil
 	}
 	return value, nil
 }
@@ -159,12 +212,45 @@ func getOutputModes(config *Config) (cFlag uint32, err error) {
 	switch config.StopBits {
 	case StopBitsOne:
 		// default
+	case StopBitsOneHalf:
+		// UARTs send 1.5 stop bits instead of 2 with 5 data bits
+		if config.DataBits != 5 {
+			return 0, fmt.Errorf("1.5 stop bits are only supported with 5 data bits")
+		}
+		cFlag |= unix.CSTOPB
 	case StopBitsTwo:
+		if config.DataBits == 5 {
+			return 0, fmt.Errorf("2 stop bits are not supported with 5 data bits")
+		}
 		cFlag |= unix.CSTOPB
 	default:
 		return 0, fmt.Errorf("Bad stop bits value")
 	}
 
+	switch config.Parity {
+	case ParityNone:
+		// default
+	case ParityOdd:
+		cFlag |= unix.PARENB | unix.PARODD
+	case ParityEven:
+		cFlag |= unix.PARENB
+	case ParityMark:
+		cFlag |= unix.PARENB | unix.PARODD | unix.CMSPAR
+	case ParitySpace:
+		cFlag |= unix.PARENB | unix.CMSPAR
+	default:
+		return 0, fmt.Errorf("Bad parity value")
+	}
+
+	switch config.FlowControl {
+	case FlowControlNone, FlowControlXONXOFF:
+		// XON/XOFF is an input mode
+	case FlowControlRTSCTS:
+		cFlag |= unix.CRTSCTS
+	default:
+		return 0, fmt.Errorf("Bad flow control value")
+	}
+
 	return cFlag, nil
 }
 
@@ -175,19 +261,79 @@ func (c *Config) toTermios() (*unix.Termios, error) {
 	}
 
 	termios := &unix.Termios{
-		Iflag: unix.INPCK,
-		Cflag: cFlag,
+		Iflag:  unix.INPCK,
+		Cflag:  cFlag,
+		Ispeed: c.BaudRate,
+		Ospeed: c.BaudRate,
+	}
+
+	if c.FlowControl == FlowControlXONXOFF {
+		termios.Iflag |= unix.IXON | unix.IXOFF
+		termios.Cc[unix.VSTART] = 0x11
+		termios.Cc[unix.VSTOP] = 0x13
 	}
 
+	// timeouts are handled by polling in Read, VTIME only has a resolution of 100ms
 	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
 
-	if c.ReadTimeout > 0 {
-		termios.Cc[unix.VMIN] = 0
-		if c.ReadTimeout > maxReadTimeout {
-			return nil, fmt.Errorf("Bad read timeout")
+	return termios, nil
+}
+
+// ReadConfig reads the line settings back from the driver. PortPath, ReadTimeout and LockTimeout
+// are the configured ones.
+func (p *Port) ReadConfig() (*Config, error) {
+	termios, err := unix.IoctlGetTermios(int(p.file.Fd()), unix.TCGETS2)
+	if err != nil {
+		return nil, err
+	}
+	config := *p.Config
+	config.fromTermios(termios)
+	return &config, nil
+}
+
+// fromTermios sets the line settings of c from termios, the inverse of toTermios
+func (c *Config) fromTermios(termios *unix.Termios) {
+	c.BaudRate = termios.Ospeed
+
+	switch termios.Cflag & unix.CSIZE {
+	case unix.CS5:
+		c.DataBits = 5
+	case unix.CS6:
+		c.DataBits = 6
+	case unix.CS7:
+		c.DataBits = 7
+	default:
+		c.DataBits = 8
+	}
+
+	c.StopBits = StopBitsOne
+	if termios.Cflag&unix.CSTOPB != 0 {
+		c.StopBits = StopBitsTwo
+		if c.DataBits == 5 {
+			c.StopBits = StopBitsOneHalf
 		}
-		termios.Cc[unix.VTIME] = uint8(c.ReadTimeout.Milliseconds() / 100)
 	}
 
-	return termios, nil
+	c.Parity = ParityNone
+	if termios.Cflag&unix.PARENB != 0 {
+		odd := termios.Cflag&unix.PARODD != 0
+		switch {
+		case termios.Cflag&unix.CMSPAR != 0 && odd:
+			c.Parity = ParityMark
+		case termios.Cflag&unix.CMSPAR != 0:
+			c.Parity = ParitySpace
+		case odd:
+			c.Parity = ParityOdd
+		default:
+			c.Parity = ParityEven
+		}
+	}
+
+	c.FlowControl = FlowControlNone
+	if termios.Cflag&unix.CRTSCTS != 0 {
+		c.FlowControl = FlowControlRTSCTS
+	} else if termios.Iflag&(unix.IXON|unix.IXOFF) != 0 {
+		c.FlowControl = FlowControlXONXOFF
+	}
 }
@@ -2,25 +2,43 @@ package common
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"time"
 )
 
+// deadlineReader is implemented by transports whose Read blocks until a deadline, like serial.Port
+type deadlineReader interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// slipReadChunkSize is how many bytes are read from the transport at once
+const slipReadChunkSize = 4096
+
 type SlipReadWriter struct {
 	BaseReadWriter io.ReadWriter
 	Timeout        time.Duration
 	logger         *log.Logger
+	chunk          []byte
+	pending        []byte // bytes read from the transport but not decoded yet
 }
 
 func NewSlipReadWriter(base io.ReadWriter, logger *log.Logger) *SlipReadWriter {
 	return &SlipReadWriter{
 		BaseReadWriter: base,
 		logger:         logger,
+		chunk:          make([]byte, slipReadChunkSize),
 	}
 }
 
+// Discard drops buffered bytes that were not decoded yet, call it after flushing the transport
+func (s *SlipReadWriter) Discard() {
+	s.pending = nil
+}
+
 const (
 	SlipHeader     byte = 0xC0
 	SlipEscapeChar byte = 0xDB
@@ -49,9 +67,14 @@ func (s *SlipReadWriter) Write(b []byte) error {
 }
 
 func (s *SlipReadWriter) Read(timeout time.Duration) ([]byte, error) {
-	// read a single byte until we find a slip header
-	byteBuf := make([]byte, 1)
 	startTime := time.Now()
+	deadline, hasDeadline := s.BaseReadWriter.(deadlineReader)
+	if hasDeadline {
+		if err := deadline.SetReadDeadline(startTime.Add(timeout)); err != nil {
+			return nil, err
+		}
+		defer deadline.SetReadDeadline(time.Time{})
+	}
 
 	// simple state machine
 	type slipReadState byte
@@ -63,38 +86,47 @@ func (s *SlipReadWriter) Read(timeout time.Duration) ([]byte, error) {
 	result := make([]byte, 0)
 
 	for {
-		if time.Since(startTime) > timeout {
-			err := fmt.Errorf("Read timeout after %v. Received %d bytes", time.Since(startTime), len(result))
-			s.logger.Print(err)
-			return nil, err
-		}
-		n, err := s.BaseReadWriter.Read(byteBuf)
-		if err != nil {
-			if err.Error() == "EOF" {
+		if len(s.pending) == 0 {
+			if time.Since(startTime) > timeout {
+				err := fmt.Errorf("Read timeout after %v. Received %d bytes", time.Since(startTime), len(result))
+				s.logger.Print(err)
+				return nil, err
+			}
+			n, err := s.BaseReadWriter.Read(s.chunk)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				// checked by the next iteration
 				continue
 			}
-			return nil, err
-		}
-		if n != 1 {
+			if err != nil {
+				if err.Error() == "EOF" {
+					continue
+				}
+				return nil, err
+			}
+			s.pending = s.chunk[:n]
 			continue
 		}
 
+		// bytes after the end of this packet stay pending for the next Read
+		b := s.pending[0]
+		s.pending = s.pending[1:]
+
 		switch state {
 		case waitingForHeader:
-			if byteBuf[0] == SlipHeader {
+			if b == SlipHeader {
 				state = readingContent
 			}
 		case readingContent:
-			switch byteBuf[0] {
+			switch b {
 			case SlipHeader:
 				return result, nil
 			case SlipEscapeChar:
 				state = inEscape
 			default:
-				result = append(result, byteBuf[0])
+				result = append(result, b)
 			}
 		case inEscape:
-			switch byteBuf[0] {
+			switch b {
 			case 0xDC:
 				result = append(result, SlipHeader)
 				state = readingContent
@@ -102,7 +134,7 @@ func (s *SlipReadWriter) Read(timeout time.Duration) ([]byte, error) {
 				result = append(result, SlipEscapeChar)
 				state = readingContent
 			default:
-				return nil, fmt.Errorf("Unexpected char %02X after escape character", byteBuf[0])
+				return nil, fmt.Errorf("Unexpected char %02X after escape character", b)
 			}
 		}
 	}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+// countingBuffer counts the Read calls reaching the transport
+type countingBuffer struct {
+	bytes.Buffer
+	reads int
+}
+
+func (c *countingBuffer) Read(b []byte) (int, error) {
+	c.reads++
+	return c.Buffer.Read(b)
+}
+
+func TestSlipReadBuffersPackets(t *testing.T) {
+	base := &countingBuffer{}
+	base.Write([]byte{0x00})
+	base.Write(SlipEncode([]byte{0x01, SlipHeader, 0x02}))
+	base.Write(SlipEncode([]byte{SlipEscapeChar, 0x03}))
+	s := NewSlipReadWriter(base, log.New(ioutil.Discard, "", 0))
+
+	for _, expected := range [][]byte{{0x01, SlipHeader, 0x02}, {SlipEscapeChar, 0x03}} {
+		packet, err := s.Read(100 * time.Millisecond)
+		if err != nil {
+			t.Fatalf("Read errored with: %v", err)
+		}
+		if !bytes.Equal(packet, expected) {
+			t.Errorf("Expected packet %X, got %X", expected, packet)
+		}
+	}
+	if base.reads != 1 {
+		t.Errorf("Expected both packets from a single transport read, got %d reads", base.reads)
+	}
+
+	base.Write(SlipEncode([]byte{0x04}))
+	base.Write(SlipEncode([]byte{0x05}))
+	if _, err := s.Read(100 * time.Millisecond); err != nil {
+		t.Fatalf("Read errored with: %v", err)
+	}
+	s.Discard()
+	if packet, err := s.Read(10 * time.Millisecond); err == nil {
+		t.Errorf("Expected the discarded packet to be gone, got %X", packet)
+	}
+}
@@ -0,0 +1,20 @@
+package common
+
+import "io"
+
+// Transport is the connection to a ROM bootloader. Besides the byte stream it
+// provides the modem control lines used by the auto-reset circuit, baud rate
+// changes and buffer flushing.
+type Transport interface {
+	io.ReadWriter
+	// SetDTR drives the DTR line, which is wired to GPIO0 on most boards
+	SetDTR(dtr bool) error
+	// SetRTS drives the RTS line, which is wired to EN on most boards
+	SetRTS(rts bool) error
+	// SetBaudrate changes the signalling rate on the host side
+	SetBaudrate(baudrate uint32) error
+	// GetBaudrate returns the signalling rate currently set on the host side
+	GetBaudrate() uint32
+	// Flush discards all data not yet read or transmitted
+	Flush() error
+}
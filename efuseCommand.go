@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fluepke/esptool/esp32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// efuseBurnConfirmation has to be typed to actually burn eFuses
+const efuseBurnConfirmation = "BURN"
+
+type EfuseSummary struct {
+	CodingScheme string
+	Blocks       []string
+	Fields       []esp32.EfuseValue
+}
+
+func NewEfuseSummary(efuses *esp32.Efuses) *EfuseSummary {
+	summary := &EfuseSummary{
+		CodingScheme: efuses.CodingScheme().String(),
+		Fields:       efuses.Values(),
+	}
+	for _, words := range efuses.Blocks {
+		hexWords := make([]string, len(words))
+		for index, word := range words {
+			hexWords[index] = fmt.Sprintf("%08X", word)
+		}
+		summary.Blocks = append(summary.Blocks, strings.Join(hexWords, " "))
+	}
+	return summary
+}
+
+func protectionString(value *esp32.EfuseValue) string {
+	protection := ""
+	if value.ReadProtected {
+		protection += "R"
+	} else {
+		protection += "-"
+	}
+	if value.WriteProtected {
+		protection += "W"
+	} else {
+		protection += "-"
+	}
+	return protection
+}
+
+func (s *EfuseSummary) String() string {
+	builder := &strings.Builder{}
+	fmt.Fprint(builder, underline(bold(("eFuse Summary"))))
+	fmt.Fprint(builder, "\n")
+	fmt.Fprintf(builder, "%s: %s\n", bold("Coding Scheme"), s.CodingScheme)
+	for index, block := range s.Blocks {
+		fmt.Fprintf(builder, "%s: %s\n", bold(fmt.Sprintf("BLK%d", index)), block)
+	}
+
+	category := ""
+	writer := tabwriter.NewWriter(builder, 0, 4, 2, ' ', 0)
+	for index := range s.Fields {
+		value := &s.Fields[index]
+		if value.Category != category {
+			writer.Flush()
+			category = value.Category
+			fmt.Fprintf(builder, "\n%s\n", bold(strings.Title(category)))
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", value.Name, value.Value, protectionString(value), value.Description)
+	}
+	writer.Flush()
+	fmt.Fprintf(builder, "\nR: read protected, W: write protected\n")
+	return builder.String()
+}
+
+func efuseSummaryCommand(jsonOutput bool, rom *esp32.ESP32ROM) error {
+	efuses, err := rom.ReadEfuses()
+	if err != nil {
+		return fmt.Errorf("Could not read eFuses: %s", err.Error())
+	}
+	summary := NewEfuseSummary(efuses)
+
+	if jsonOutput {
+		prettyJson, err := json.MarshalIndent(summary, "", "  ")
+
+		if err != nil {
+			return fmt.Errorf("Could not generate JSON outputs: %s", err.Error())
+		}
+		_, err = os.Stdout.Write(prettyJson)
+		return err
+	}
+
+	_, err = fmt.Println(summary.String())
+
+	return err
+}
+
+// efuseBurnCommand burns FIELD=value arguments after showing the pending changes and reading
+// the confirmation from input. Values starting with @ are read from a binary file, e.g. keys.
+func efuseBurnCommand(rom *esp32.ESP32ROM, assignments []string, dryRun bool, input io.Reader) error {
+	if len(assignments) == 0 {
+		return fmt.Errorf("No fields given, expected one or more FIELD=value arguments")
+	}
+	efuses, err := rom.ReadEfuses()
+	if err != nil {
+		return fmt.Errorf("Could not read eFuses: %s", err.Error())
+	}
+	burn := esp32.NewEfuseBurn(efuses)
+	for _, assignment := range assignments {
+		parts := strings.SplitN(assignment, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid argument '%s', expected FIELD=value", assignment)
+		}
+		value := parts[1]
+		if strings.HasPrefix(value, "@") {
+			contents, err := ioutil.ReadFile(value[1:])
+			if err != nil {
+				return err
+			}
+			value = hex.EncodeToString(contents)
+		}
+		if err = burn.Set(parts[0], value); err != nil {
+			return err
+		}
+	}
+
+	fmt.Print(efuseBurnString(burn))
+	if burn.Empty() {
+		fmt.Println("All bits are burned already, nothing to do")
+		return nil
+	}
+	if dryRun {
+		fmt.Println("Dry run, no eFuses were burned")
+		return nil
+	}
+
+	fmt.Printf("Burning eFuses is irreversible. Type %s to continue: ", efuseBurnConfirmation)
+	line, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.TrimSpace(line) != efuseBurnConfirmation {
+		return fmt.Errorf("Aborted, no eFuses were burned")
+	}
+	if err = rom.BurnEfuses(burn); err != nil {
+		return fmt.Errorf("Could not burn eFuses: %s", err.Error())
+	}
+	fmt.Println("eFuses burned successfully")
+	return nil
+}
+
+func efuseBurnString(burn *esp32.EfuseBurn) string {
+	builder := &strings.Builder{}
+	fmt.Fprint(builder, underline(bold("Pending eFuse Changes")))
+	fmt.Fprint(builder, "\n")
+	writer := tabwriter.NewWriter(builder, 0, 4, 2, ' ', 0)
+	for _, change := range burn.Changes {
+		fmt.Fprintf(writer, "%s\t%s\t->\t%s\n", change.Name, change.Old, change.New)
+	}
+	writer.Flush()
+	fmt.Fprint(builder, "\n")
+	for _, change := range burn.WordChanges() {
+		fmt.Fprintf(builder, "%s: %08X -> %08X (bits %08X)\n", bold(fmt.Sprintf("BLK%d word %d", change.Block, change.Word)), change.Old, change.New, change.New&^change.Old)
+	}
+	return builder.String()
+}
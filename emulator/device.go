@@ -0,0 +1,364 @@
+package emulator
+
+import (
+	"bytes"
+	"github.com/fluepke/esptool/common"
+	"io/ioutil"
+	"log"
+	"math/bits"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	efuseRegBase       uint32 = 0x6001a000
+	chipDetectMagicReg uint32 = 0x40001000
+	spiCmdUsr          uint32 = 1 << 18
+	esp8266OTPBase     uint32 = 0x3ff00050
+	uartClkDivReg      uint32 = 0x3ff40014
+
+	flashManufacturerGigaDevice uint32 = 0xC8
+	flashMemoryType             uint32 = 0x40
+	spiFlashCommandRDID         uint32 = 0x9F
+
+	chipDetectMagicESP32   uint32 = 0x00f01d83
+	chipDetectMagicESP8266 uint32 = 0xfff0c101
+	flashSectorSize        uint32 = 0x1000
+	defaultBaudrate        uint32 = 115200
+	defaultXtalFrequency   uint32 = 40
+)
+
+var (
+	bootMessage        = []byte("ets Jun  8 2016 00:22:57\r\n\r\nrst:0x1 (POWERON_RESET),boot:0x3 (DOWNLOAD_BOOT(UART0/UART1/SDIO_REI_REO_V2))\r\nwaiting for download\r\n")
+	esp8266BootMessage = []byte("\r\n ets Jan  8 2013,rst cause:2, boot mode:(1,7)\r\n\r\n")
+
+	// esp32Spi is SPI1 of the ESP32, esp8266Spi is SPI0 of the ESP8266
+	esp32Spi   = spiRegisters{cmd: 0x3ff42000, usr2: 0x3ff42024, w0: 0x3ff42080}
+	esp8266Spi = spiRegisters{cmd: 0x60000200, usr2: 0x60000224, w0: 0x60000240}
+
+	// esp8266ROMMissing are the commands the ESP8266 ROM does not implement
+	esp8266ROMMissing = map[common.Opcode]bool{
+		common.OpcodeSpiAttachFlash: true,
+		common.OpcodeReadFlash:      true,
+		common.OpcodeChangeBaudrate: true,
+		common.OpcodeFlashDeflBegin: true,
+		common.OpcodeFlashDeflData:  true,
+		common.OpcodeFlashDeflEnd:   true,
+		common.OpcodeSpiFlashMd5:    true,
+	}
+)
+
+// Device emulates an ESP32, or an ESP8266 if created by NewESP8266Device, in UART download
+// mode. It implements common.Transport, so an esp32.ESP32ROM can be pointed at it directly.
+type Device struct {
+	// Flash holds the contents of the virtual SPI flash
+	Flash []byte
+	// Registers holds the values returned by READ_REG, including the eFuse words
+	Registers map[uint32]uint32
+	// FlashID is the JEDEC ID the flash chip answers RDID with, manufacturer in the lowest byte
+	FlashID uint32
+	// Baudrate is the signalling rate the emulated chip currently uses
+	Baudrate uint32
+	// ReadTimeout is the time Read waits for data before returning zero bytes
+	ReadTimeout time.Duration
+	// XtalFrequency is the crystal frequency in MHz, the UART clock divider is derived from it
+	XtalFrequency uint32
+	// EfuseFile is updated with the raw eFuse blocks every time eFuses are programmed, if set
+	EfuseFile string
+
+	mutex         sync.Mutex
+	dataAvailable chan struct{}
+	output        bytes.Buffer
+	decoder       slipDecoder
+	hostBaudrate  uint32
+	pty           bool
+	dtr           bool
+	rts           bool
+	inReset       bool
+	downloadMode  bool
+	flashAttached bool
+	stub          bool
+	write         *flashWrite
+	memory        *memoryWrite
+	read          *flashRead
+	ram           map[uint32][]byte
+	efuses        [efuseBlockCount][]uint32
+	esp8266       bool
+	spi           spiRegisters
+	logger        *log.Logger
+}
+
+// spiRegisters are the registers of the SPI peripheral connected to the flash chip
+type spiRegisters struct {
+	cmd  uint32
+	usr2 uint32
+	w0   uint32
+}
+
+// flashWrite tracks a FLASH_BEGIN/FLASH_DEFL_BEGIN sequence
+type flashWrite struct {
+	offset     uint32
+	blockSize  uint32
+	numBlocks  uint32
+	sequence   uint32
+	compressed bool
+	deflated   []byte
+}
+
+// memoryWrite tracks a MEM_BEGIN sequence
+type memoryWrite struct {
+	offset    uint32
+	size      uint32
+	blockSize uint32
+	sequence  uint32
+	data      []byte
+}
+
+// flashRead tracks a streaming stub READ_FLASH
+type flashRead struct {
+	offset      uint32
+	size        uint32
+	packetSize  uint32
+	maxInFlight uint32
+	sent        uint32
+	acked       uint32
+}
+
+// NewDevice creates an ESP32D0WDQ6 revision 1 with an erased flash of the given size.
+// The device starts in download mode, as if it had just been reset into the bootloader.
+func NewDevice(flashSize int, logger *log.Logger) *Device {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	d := &Device{
+		Flash:         bytes.Repeat([]byte{0xFF}, flashSize),
+		Registers:     map[uint32]uint32{},
+		FlashID:       flashManufacturerGigaDevice | flashMemoryType<<8 | uint32(bits.TrailingZeros(uint(flashSize)))<<16,
+		ram:           map[uint32][]byte{},
+		Baudrate:      defaultBaudrate,
+		XtalFrequency: defaultXtalFrequency,
+		ReadTimeout:   1 * time.Millisecond,
+		dataAvailable: make(chan struct{}, 1),
+		hostBaudrate:  defaultBaudrate,
+		downloadMode:  true,
+		efuses:        newEfuseBlocks(),
+		spi:           esp32Spi,
+		logger:        logger,
+	}
+	d.Registers[chipDetectMagicReg] = chipDetectMagicESP32
+	d.SetEfuse(3, 0x00008000) // ESP32D0WDQ6, CHIP_VER_REV1
+	d.SetEfuse(4, 0x00000800) // ADC_VREF calibrated
+	d.SetMAC(net.HardwareAddr{0x24, 0x6f, 0x28, 0x92, 0xef, 0x20})
+	return d
+}
+
+// NewESP8266Device creates an ESP8266EX with the MAC address 18:fe:34:12:34:56 and an erased
+// flash of the given size. Its ROM lacks the commands the ESP8266 ROM lacks and erases too much
+// on FLASH_BEGIN, just like the real one.
+func NewESP8266Device(flashSize int, logger *log.Logger) *Device {
+	d := NewDevice(flashSize, logger)
+	d.esp8266 = true
+	d.spi = esp8266Spi
+	d.Registers = map[uint32]uint32{
+		chipDetectMagicReg: chipDetectMagicESP8266,
+		// MAC0 to MAC3, with MAC3 empty the OUI is selected by MAC1
+		esp8266OTPBase + 0x0: 0x56000000,
+		esp8266OTPBase + 0x4: 0x00001234,
+	}
+	return d
+}
+
+// SetEfuse sets word index of eFuse block 0
+func (d *Device) SetEfuse(index uint32, value uint32) {
+	d.SetEfuseWord(0, int(index), value)
+}
+
+// SetMAC programs the factory MAC address and its CRC into eFuse block 0
+func (d *Device) SetMAC(mac net.HardwareAddr) {
+	crc := byte(0)
+	for _, b := range mac {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8C
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	d.SetEfuse(1, uint32(mac[2])<<24|uint32(mac[3])<<16|uint32(mac[4])<<8|uint32(mac[5]))
+	d.SetEfuse(2, uint32(crc)<<16|uint32(mac[0])<<8|uint32(mac[1]))
+}
+
+// Read returns data sent by the emulated chip. If there is none, it waits for up
+// to ReadTimeout and returns zero bytes, just like a serial port with VTIME set.
+func (d *Device) Read(b []byte) (int, error) {
+	d.mutex.Lock()
+	if d.output.Len() == 0 {
+		d.mutex.Unlock()
+		select {
+		case <-d.dataAvailable:
+		case <-time.After(d.ReadTimeout):
+		}
+		d.mutex.Lock()
+	}
+	defer d.mutex.Unlock()
+	if d.output.Len() == 0 {
+		return 0, nil
+	}
+	return d.output.Read(b)
+}
+
+// Write passes data to the emulated chip. Complete SLIP frames are executed immediately.
+func (d *Device) Write(b []byte) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	// a pty has no line rate the host could get wrong
+	if (d.hostBaudrate != d.Baudrate && !d.pty) || d.inReset {
+		// the chip can't make sense of what it receives
+		return len(b), nil
+	}
+	for _, c := range b {
+		frame := d.decoder.decode(c)
+		if frame == nil || !d.downloadMode {
+			continue
+		}
+		d.handleFrame(frame)
+	}
+	return len(b), nil
+}
+
+// SetDTR drives GPIO0 through the usual auto-reset circuit
+func (d *Device) SetDTR(dtr bool) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.dtr = dtr
+	return nil
+}
+
+// SetRTS drives EN through the usual auto-reset circuit. Releasing EN boots the
+// chip, into download mode if GPIO0 is held low at that moment.
+func (d *Device) SetRTS(rts bool) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.rts = rts
+	if rts {
+		d.inReset = true
+		return nil
+	}
+	if d.inReset {
+		d.inReset = false
+		d.boot(d.dtr)
+	}
+	return nil
+}
+
+// SetBaudrate changes the signalling rate of the host side
+func (d *Device) SetBaudrate(baudrate uint32) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.hostBaudrate = baudrate
+	return nil
+}
+
+// GetBaudrate returns the signalling rate of the host side
+func (d *Device) GetBaudrate() uint32 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.hostBaudrate
+}
+
+// Flush discards all data not yet read by the host
+func (d *Device) Flush() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.output.Reset()
+	d.decoder.reset()
+	return nil
+}
+
+func (d *Device) boot(downloadMode bool) {
+	d.Baudrate = defaultBaudrate
+	d.downloadMode = downloadMode
+	d.flashAttached = false
+	d.stub = false
+	d.write = nil
+	d.memory = nil
+	d.read = nil
+	d.ram = map[uint32][]byte{}
+	d.decoder.reset()
+	message := bootMessage
+	if d.esp8266 {
+		// the OTP words are plain registers, there is no eFuse controller to load them
+		message = esp8266BootMessage
+	} else {
+		d.loadEfuses()
+	}
+	if downloadMode {
+		d.logger.Print("Booted into download mode")
+		d.send(message)
+	} else {
+		d.logger.Print("Booted into application")
+	}
+}
+
+// IsStub returns true if a flasher stub has been uploaded and started
+func (d *Device) IsStub() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.stub
+}
+
+// send queues raw bytes for the host, must be called with the mutex held
+func (d *Device) send(b []byte) {
+	d.output.Write(b)
+	select {
+	case d.dataAvailable <- struct{}{}:
+	default:
+	}
+}
+
+// slipDecoder reassembles SLIP frames from a byte stream
+type slipDecoder struct {
+	inFrame  bool
+	inEscape bool
+	frame    []byte
+}
+
+func (s *slipDecoder) reset() {
+	s.inFrame = false
+	s.inEscape = false
+	s.frame = nil
+}
+
+// decode consumes a single byte and returns the frame it completes, if any
+func (s *slipDecoder) decode(c byte) []byte {
+	switch {
+	case c == common.SlipHeader:
+		if s.inFrame && len(s.frame) > 0 {
+			frame := s.frame
+			s.reset()
+			return frame
+		}
+		s.reset()
+		s.inFrame = true
+	case !s.inFrame:
+		// garbage between frames
+	case s.inEscape:
+		s.inEscape = false
+		switch c {
+		case 0xDC:
+			s.frame = append(s.frame, common.SlipHeader)
+		case 0xDD:
+			s.frame = append(s.frame, common.SlipEscapeChar)
+		default:
+			s.reset()
+		}
+	case c == common.SlipEscapeChar:
+		s.inEscape = true
+	default:
+		s.frame = append(s.frame, c)
+	}
+	return nil
+}
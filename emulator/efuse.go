@@ -0,0 +1,218 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	efuseBlockCount  = 4
+	efuseBlock0Words = 7
+	efuseBlockWords  = 8
+
+	efuseClkReg       uint32 = efuseRegBase + 0x0f8
+	efuseConfReg      uint32 = efuseRegBase + 0x0fc
+	efuseCmdReg       uint32 = efuseRegBase + 0x104
+	efuseDacConfReg   uint32 = efuseRegBase + 0x118
+	efuseDecStatusReg uint32 = efuseRegBase + 0x11c
+
+	efuseConfRead    uint32 = 0x5AA5
+	efuseConfWrite   uint32 = 0x5A5A
+	efuseCmdRead     uint32 = 0x1
+	efuseCmdProgram  uint32 = 0x2
+	efuseCoding34    uint32 = 1
+	efuseWrDisBlock1        = 7 // BLK2 and BLK3 follow
+	efuseRdDisBlock1        = 0
+)
+
+var (
+	efuseReadRegs  = [efuseBlockCount]uint32{efuseRegBase + 0x000, efuseRegBase + 0x038, efuseRegBase + 0x058, efuseRegBase + 0x078}
+	efuseWriteRegs = [efuseBlockCount]uint32{efuseRegBase + 0x01c, efuseRegBase + 0x098, efuseRegBase + 0x0b8, efuseRegBase + 0x0d8}
+
+	// efuseTimings are EFUSE_CLK_REG and EFUSE_DAC_CLK_DIV for each crystal frequency in MHz
+	efuseTimings = map[uint32][2]uint32{
+		26: {255<<8 | 250, 52},
+		40: {255<<8 | 160, 80},
+	}
+)
+
+// efuseFile is the format in which eFuses are stored by SaveEfuses
+type efuseFile struct {
+	// Blocks holds the raw, possibly 3/4 encoded words of BLK0 to BLK3 in hex
+	Blocks []string
+}
+
+func newEfuseBlocks() [efuseBlockCount][]uint32 {
+	var blocks [efuseBlockCount][]uint32
+	blocks[0] = make([]uint32, efuseBlock0Words)
+	for block := 1; block < efuseBlockCount; block++ {
+		blocks[block] = make([]uint32, efuseBlockWords)
+	}
+	return blocks
+}
+
+// SetEfuseWord sets a raw word of an eFuse block, as if it had been burned at the factory
+func (d *Device) SetEfuseWord(block int, index int, value uint32) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.efuses[block][index] = value
+	d.loadEfuses()
+}
+
+// LoadEfuses replaces the eFuses with those stored in a file written by SaveEfuses
+func (d *Device) LoadEfuses(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file := &efuseFile{}
+	if err = json.Unmarshal(contents, file); err != nil {
+		return fmt.Errorf("Invalid eFuse file %s: %v", path, err)
+	}
+	if len(file.Blocks) != efuseBlockCount {
+		return fmt.Errorf("Invalid eFuse file %s: expected %d blocks, found %d", path, efuseBlockCount, len(file.Blocks))
+	}
+	blocks := newEfuseBlocks()
+	for block, hexWords := range file.Blocks {
+		words := strings.Fields(hexWords)
+		if len(words) != len(blocks[block]) {
+			return fmt.Errorf("Invalid eFuse file %s: expected %d words in block %d, found %d", path, len(blocks[block]), block, len(words))
+		}
+		for index, word := range words {
+			value, err := strconv.ParseUint(word, 16, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid eFuse file %s: %v", path, err)
+			}
+			blocks[block][index] = uint32(value)
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.efuses = blocks
+	d.loadEfuses()
+	return nil
+}
+
+// SaveEfuses stores the raw eFuse blocks in a file
+func (d *Device) SaveEfuses(path string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.saveEfuses(path)
+}
+
+func (d *Device) saveEfuses(path string) error {
+	file := &efuseFile{}
+	for _, words := range d.efuses {
+		hexWords := make([]string, len(words))
+		for index, word := range words {
+			hexWords[index] = fmt.Sprintf("%08X", word)
+		}
+		file.Blocks = append(file.Blocks, strings.Join(hexWords, " "))
+	}
+	contents, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, os.FileMode(0644))
+}
+
+// loadEfuses updates the read registers from the raw eFuse blocks like the chip does on
+// reset or on a read command, must be called with the mutex held
+func (d *Device) loadEfuses() {
+	coding34 := d.efuses[0][6]&0x03 == efuseCoding34
+	rdDis := d.efuses[0][0] >> 16 & 0x0F
+	decodeErrors := uint32(0)
+	for block := 0; block < efuseBlockCount; block++ {
+		words := d.efuses[block]
+		if block > 0 && coding34 {
+			var ok bool
+			words, ok = decodeEfuse34(words)
+			if !ok {
+				decodeErrors |= 1 << uint(block)
+			}
+		}
+		readProtected := block > 0 && rdDis&(1<<uint(efuseRdDisBlock1+block-1)) != 0
+		for index, word := range words {
+			if readProtected {
+				word = 0
+			}
+			d.Registers[efuseReadRegs[block]+4*uint32(index)] = word
+		}
+	}
+	d.Registers[efuseDecStatusReg] = decodeErrors
+}
+
+// programEfuses burns the bits set in the write registers and clears them,
+// must be called with the mutex held
+func (d *Device) programEfuses() {
+	timing := efuseTimings[d.XtalFrequency]
+	if d.Registers[efuseClkReg]&0xFFFF != timing[0] || d.Registers[efuseDacConfReg]&0xFF != timing[1] {
+		// the real chip would burn unreliably, burn nothing to make it noticeable
+		d.logger.Printf("Not programming eFuses with a timing unfit for a %dMHz crystal", d.XtalFrequency)
+		return
+	}
+	wrDis := d.efuses[0][0] & 0xFFFF
+	for block := 0; block < efuseBlockCount; block++ {
+		// write protection of BLK0 fields is not emulated
+		writeProtected := block > 0 && wrDis&(1<<uint(efuseWrDisBlock1+block-1)) != 0
+		for index := range d.efuses[block] {
+			register := efuseWriteRegs[block] + 4*uint32(index)
+			if !writeProtected {
+				d.efuses[block][index] |= d.Registers[register]
+			}
+			d.Registers[register] = 0
+		}
+	}
+	if d.EfuseFile != "" {
+		if err := d.saveEfuses(d.EfuseFile); err != nil {
+			d.logger.Printf("Saving eFuses to %s failed: %v", d.EfuseFile, err)
+		}
+	}
+}
+
+// handleEfuseCommand executes a command written to EFUSE_CMD_REG, must be called with the mutex held
+func (d *Device) handleEfuseCommand() {
+	switch {
+	case d.Registers[efuseCmdReg] == efuseCmdProgram && d.Registers[efuseConfReg] == efuseConfWrite:
+		d.logger.Print("Programming eFuses")
+		d.programEfuses()
+	case d.Registers[efuseCmdReg] == efuseCmdRead && d.Registers[efuseConfReg] == efuseConfRead:
+		d.loadEfuses()
+	default:
+		d.logger.Printf("Ignoring eFuse command %X with configuration %X", d.Registers[efuseCmdReg], d.Registers[efuseConfReg])
+	}
+	d.Registers[efuseCmdReg] = 0
+}
+
+// decodeEfuse34 strips the check bytes from a 3/4 encoded block, ok is false if they don't match
+func decodeEfuse34(words []uint32) (decoded []uint32, ok bool) {
+	raw := make([]byte, 0, 4*len(words))
+	for _, word := range words {
+		raw = append(raw, byte(word), byte(word>>8), byte(word>>16), byte(word>>24))
+	}
+	data := make([]byte, 0, len(raw)*3/4)
+	ok = true
+	for offset := 0; offset < len(raw); offset += 8 {
+		chunk := raw[offset : offset+6]
+		xor, weight := byte(0), 0
+		for index, b := range chunk {
+			xor ^= b
+			weight += (index + 1) * bits.OnesCount8(b)
+		}
+		if raw[offset+6] != xor || raw[offset+7] != byte(weight) {
+			ok = false
+		}
+		data = append(data, chunk...)
+	}
+	decoded = make([]uint32, len(words))
+	for index := 0; index < len(data)/4; index++ {
+		decoded[index] = uint32(data[4*index]) | uint32(data[4*index+1])<<8 | uint32(data[4*index+2])<<16 | uint32(data[4*index+3])<<24
+	}
+	return decoded, ok
+}
@@ -0,0 +1,503 @@
+package emulator
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/fluepke/esptool/common"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	romStatusLength        = 4
+	esp8266ROMStatusLength = 2
+	stubStatusLength       = 2
+	romReadFlashMax        = 64
+	syncResponseCount      = 8
+)
+
+// handleFrame executes a single request frame, must be called with the mutex held
+func (d *Device) handleFrame(frame []byte) {
+	if d.read != nil {
+		d.handleReadFlashAck(frame)
+		return
+	}
+	if len(frame) < 8 || common.Direction(frame[0]) != common.DirectionRequest {
+		d.logger.Printf("Ignoring malformed frame %X", frame)
+		return
+	}
+	opcode := common.Opcode(frame[1])
+	checksum := binary.LittleEndian.Uint32(frame[4:8])
+	payload := frame[8:]
+	if int(binary.LittleEndian.Uint16(frame[2:4])) != len(payload) {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	d.logger.Printf("Received command %s with %d bytes of payload", opcode.String(), len(payload))
+	if d.esp8266 && !d.stub && esp8266ROMMissing[opcode] {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+
+	switch opcode {
+	case common.OpcodeSync:
+		for i := 0; i < syncResponseCount; i++ {
+			d.respond(opcode, 0, nil)
+		}
+	case common.OpcodeReadReg:
+		if len(payload) != 4 {
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		d.respond(opcode, d.readRegister(binary.LittleEndian.Uint32(payload)), nil)
+	case common.OpcodeWriteReg:
+		if len(payload)%16 != 0 || len(payload) == 0 {
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		for i := 0; i < len(payload); i += 16 {
+			d.writeRegister(
+				binary.LittleEndian.Uint32(payload[i:i+4]),
+				binary.LittleEndian.Uint32(payload[i+4:i+8]),
+				binary.LittleEndian.Uint32(payload[i+8:i+12]),
+			)
+		}
+		d.respond(opcode, 0, nil)
+	case common.OpcodeSpiAttachFlash:
+		d.flashAttached = true
+		d.respond(opcode, 0, nil)
+	case common.OpcodeChangeBaudrate:
+		if len(payload) != 8 {
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		// the stub derives the UART clock from the current rate, the ROM expects 0
+		if oldBaudrate := binary.LittleEndian.Uint32(payload[4:]); d.stub && oldBaudrate != d.Baudrate {
+			d.logger.Printf("Stub got current baudrate %d, but runs at %d", oldBaudrate, d.Baudrate)
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		d.respond(opcode, 0, nil)
+		d.Baudrate = binary.LittleEndian.Uint32(payload)
+	case common.OpcodeReadFlash:
+		if d.stub {
+			// the stub only knows the streaming variant
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		d.handleReadFlash(payload)
+	case common.OpcodeReadFlashFast:
+		if !d.stub {
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		d.handleReadFlashFast(payload)
+	case common.OpcodeFlashBegin, common.OpcodeFlashDeflBegin:
+		d.handleFlashBegin(opcode, payload)
+	case common.OpcodeFlashData, common.OpcodeFlashDeflData:
+		d.handleFlashData(opcode, checksum, payload)
+	case common.OpcodeFlashEnd, common.OpcodeFlashDeflEnd:
+		d.handleFlashEnd(opcode, payload)
+	case common.OpcodeSpiFlashMd5:
+		d.handleFlashMD5(payload)
+	case common.OpcodeEraseFlash, common.OpcodeEraseRegion:
+		if !d.stub {
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		d.handleErase(opcode, payload)
+	case common.OpcodeMemBegin:
+		d.handleMemBegin(payload)
+	case common.OpcodeMemData:
+		d.handleMemData(checksum, payload)
+	case common.OpcodeMemEnd:
+		d.handleMemEnd(payload)
+	case common.OpcodeRunUserCode:
+		if !d.stub {
+			d.fail(opcode, common.ReceivedMessageInvalid)
+			return
+		}
+		// the stub jumps into the application without responding
+		d.boot(false)
+	default:
+		d.fail(opcode, common.ReceivedMessageInvalid)
+	}
+}
+
+// readRegister returns the value of a register, the UART clock divider of the ESP32 follows the baudrate
+func (d *Device) readRegister(register uint32) uint32 {
+	if register == uartClkDivReg && !d.esp8266 {
+		return d.XtalFrequency * 1000000 / d.Baudrate
+	}
+	return d.Registers[register]
+}
+
+// writeRegister updates the bits in mask of a register. Starting a user command on the SPI
+// peripheral executes it on the emulated flash chip right away, eFuse commands are handled likewise.
+func (d *Device) writeRegister(register uint32, value uint32, mask uint32) {
+	d.Registers[register] = d.Registers[register]&^mask | value&mask
+	if register == efuseCmdReg {
+		d.handleEfuseCommand()
+		return
+	}
+	if register != d.spi.cmd || d.Registers[d.spi.cmd]&spiCmdUsr == 0 {
+		return
+	}
+	command := d.Registers[d.spi.usr2] & 0xFFFF
+	switch command {
+	case spiFlashCommandRDID:
+		d.Registers[d.spi.w0] = d.FlashID
+	default:
+		d.logger.Printf("Ignoring unknown SPI flash command %02X", command)
+	}
+	d.Registers[d.spi.cmd] &^= spiCmdUsr
+}
+
+func (d *Device) handleReadFlash(payload []byte) {
+	opcode := common.OpcodeReadFlash
+	if len(payload) != 8 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	offset := binary.LittleEndian.Uint32(payload[0:4])
+	size := binary.LittleEndian.Uint32(payload[4:8])
+	if size > romReadFlashMax {
+		d.fail(opcode, common.FlashReadLengthError)
+		return
+	}
+	if !d.flashAttached || !d.inFlash(offset, size) {
+		d.fail(opcode, common.FlashReadError)
+		return
+	}
+	d.respond(opcode, 0, d.Flash[offset:offset+size])
+}
+
+func (d *Device) handleReadFlashFast(payload []byte) {
+	opcode := common.OpcodeReadFlashFast
+	if len(payload) != 16 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	read := &flashRead{
+		offset:      binary.LittleEndian.Uint32(payload[0:4]),
+		size:        binary.LittleEndian.Uint32(payload[4:8]),
+		packetSize:  binary.LittleEndian.Uint32(payload[8:12]),
+		maxInFlight: binary.LittleEndian.Uint32(payload[12:16]),
+	}
+	if !d.flashAttached || !d.inFlash(read.offset, read.size) || read.packetSize == 0 || read.maxInFlight == 0 {
+		d.fail(opcode, common.FailedToActOnReceivedMessage)
+		return
+	}
+	d.respond(opcode, 0, nil)
+	d.read = read
+	d.sendReadFlashPackets()
+}
+
+// sendReadFlashPackets sends as many packets as the window of unacknowledged data allows
+func (d *Device) sendReadFlashPackets() {
+	read := d.read
+	for read.sent < read.size && read.sent-read.acked < read.maxInFlight*read.packetSize {
+		packetSize := read.size - read.sent
+		if packetSize > read.packetSize {
+			packetSize = read.packetSize
+		}
+		start := read.offset + read.sent
+		d.send(common.SlipEncode(d.Flash[start : start+packetSize]))
+		read.sent += packetSize
+	}
+}
+
+// handleReadFlashAck processes the host acknowledging the number of bytes received so far
+func (d *Device) handleReadFlashAck(frame []byte) {
+	if len(frame) != 4 {
+		d.logger.Printf("Aborting flash read, received %X instead of an acknowledgement", frame)
+		d.read = nil
+		return
+	}
+	d.read.acked = binary.LittleEndian.Uint32(frame)
+	if d.read.acked < d.read.size {
+		d.sendReadFlashPackets()
+		return
+	}
+	digest := md5.Sum(d.Flash[d.read.offset : d.read.offset+d.read.size])
+	d.read = nil
+	d.send(common.SlipEncode(digest[:]))
+}
+
+func (d *Device) handleFlashBegin(opcode common.Opcode, payload []byte) {
+	// ROMs of chips supporting flash encryption take a fifth word, which is ignored here
+	if len(payload) != 16 && (len(payload) != 20 || d.stub) {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	eraseSize := binary.LittleEndian.Uint32(payload[0:4])
+	write := &flashWrite{
+		numBlocks:  binary.LittleEndian.Uint32(payload[4:8]),
+		blockSize:  binary.LittleEndian.Uint32(payload[8:12]),
+		offset:     binary.LittleEndian.Uint32(payload[12:16]),
+		compressed: opcode == common.OpcodeFlashDeflBegin,
+	}
+	esp8266ROM := d.esp8266 && !d.stub
+	if esp8266ROM {
+		// the ROM has no SPI_ATTACH, FLASH_BEGIN attaches the flash
+		d.flashAttached = true
+	}
+	if !d.flashAttached || !d.inFlash(write.offset, eraseSize) {
+		d.fail(opcode, common.FailedToActOnReceivedMessage)
+		return
+	}
+	if esp8266ROM {
+		eraseSize = esp8266ROMEraseSize(write.offset, eraseSize)
+	}
+	d.erase(write.offset, eraseSize)
+	d.write = write
+	d.respond(opcode, 0, nil)
+}
+
+func (d *Device) handleFlashData(opcode common.Opcode, checksum uint32, payload []byte) {
+	if len(payload) < 16 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	size := binary.LittleEndian.Uint32(payload[0:4])
+	sequence := binary.LittleEndian.Uint32(payload[4:8])
+	data := payload[16:]
+	if int(size) != len(data) {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	if d.write == nil || d.write.compressed != (opcode == common.OpcodeFlashDeflData) || sequence != d.write.sequence {
+		d.fail(opcode, common.FailedToActOnReceivedMessage)
+		return
+	}
+	if calculateChecksum(data) != checksum {
+		d.fail(opcode, common.InvalidCRC)
+		return
+	}
+
+	if d.write.compressed {
+		d.write.deflated = append(d.write.deflated, data...)
+		// the zlib stream is inflated from the start on every block, which keeps the
+		// flash contents consistent without a decompressor running in the background
+		reader, err := zlib.NewReader(bytes.NewReader(d.write.deflated))
+		if err != nil {
+			d.fail(opcode, common.DeflateError)
+			return
+		}
+		data, err = ioutil.ReadAll(reader)
+		if err != nil && (err != io.ErrUnexpectedEOF || sequence+1 == d.write.numBlocks) {
+			d.fail(opcode, common.DeflateError)
+			return
+		}
+		if !d.program(d.write.offset, data) {
+			d.fail(opcode, common.FlashWriteError)
+			return
+		}
+	} else if !d.program(d.write.offset+sequence*d.write.blockSize, data) {
+		d.fail(opcode, common.FlashWriteError)
+		return
+	}
+	d.write.sequence++
+	d.respond(opcode, 0, nil)
+}
+
+// handleFlashEnd reboots on 0. Otherwise the stub stays in the loader, while the ROM leaves it
+// to run the user code.
+func (d *Device) handleFlashEnd(opcode common.Opcode, payload []byte) {
+	if len(payload) != 4 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	d.write = nil
+	d.respond(opcode, 0, nil)
+	if binary.LittleEndian.Uint32(payload) == 0 || !d.stub {
+		d.boot(false)
+	}
+}
+
+func (d *Device) handleFlashMD5(payload []byte) {
+	opcode := common.OpcodeSpiFlashMd5
+	if len(payload) != 16 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	offset := binary.LittleEndian.Uint32(payload[0:4])
+	size := binary.LittleEndian.Uint32(payload[4:8])
+	if !d.flashAttached || !d.inFlash(offset, size) {
+		d.fail(opcode, common.FlashReadError)
+		return
+	}
+	digest := md5.Sum(d.Flash[offset : offset+size])
+	if d.stub {
+		d.respond(opcode, 0, digest[:])
+		return
+	}
+	d.respond(opcode, 0, []byte(hex.EncodeToString(digest[:])))
+}
+
+func (d *Device) handleErase(opcode common.Opcode, payload []byte) {
+	if opcode == common.OpcodeEraseFlash {
+		d.erase(0, uint32(len(d.Flash)))
+		d.respond(opcode, 0, nil)
+		return
+	}
+	if len(payload) != 8 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	offset := binary.LittleEndian.Uint32(payload[0:4])
+	size := binary.LittleEndian.Uint32(payload[4:8])
+	if offset%flashSectorSize != 0 || size%flashSectorSize != 0 || !d.inFlash(offset, size) {
+		d.fail(opcode, common.FailedToActOnReceivedMessage)
+		return
+	}
+	d.erase(offset, size)
+	d.respond(opcode, 0, nil)
+}
+
+func (d *Device) handleMemBegin(payload []byte) {
+	opcode := common.OpcodeMemBegin
+	if len(payload) != 16 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	d.memory = &memoryWrite{
+		size:      binary.LittleEndian.Uint32(payload[0:4]),
+		blockSize: binary.LittleEndian.Uint32(payload[8:12]),
+		offset:    binary.LittleEndian.Uint32(payload[12:16]),
+	}
+	d.respond(opcode, 0, nil)
+}
+
+func (d *Device) handleMemData(checksum uint32, payload []byte) {
+	opcode := common.OpcodeMemData
+	if len(payload) < 16 || int(binary.LittleEndian.Uint32(payload[0:4])) != len(payload)-16 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	data := payload[16:]
+	if d.memory == nil || binary.LittleEndian.Uint32(payload[4:8]) != d.memory.sequence || uint32(len(d.memory.data)+len(data)) > d.memory.size {
+		d.fail(opcode, common.FailedToActOnReceivedMessage)
+		return
+	}
+	if calculateChecksum(data) != checksum {
+		d.fail(opcode, common.InvalidCRC)
+		return
+	}
+	d.memory.data = append(d.memory.data, data...)
+	d.memory.sequence++
+	if uint32(len(d.memory.data)) == d.memory.size {
+		d.ram[d.memory.offset] = d.memory.data
+	}
+	d.respond(opcode, 0, nil)
+}
+
+func (d *Device) handleMemEnd(payload []byte) {
+	opcode := common.OpcodeMemEnd
+	if len(payload) != 8 {
+		d.fail(opcode, common.ReceivedMessageInvalid)
+		return
+	}
+	d.memory = nil
+	if binary.LittleEndian.Uint32(payload[0:4]) != 0 {
+		d.respond(opcode, 0, nil)
+		return
+	}
+	entry := binary.LittleEndian.Uint32(payload[4:8])
+	if !d.inRAM(entry) {
+		d.fail(opcode, common.FailedToActOnReceivedMessage)
+		return
+	}
+	d.respond(opcode, 0, nil)
+
+	// whatever has been uploaded is assumed to be a flasher stub
+	d.logger.Printf("Jumping to %08X, running flasher stub", entry)
+	d.stub = true
+	d.flashAttached = false
+	d.send(common.SlipEncode([]byte("OHAI")))
+}
+
+func (d *Device) inRAM(address uint32) bool {
+	for offset, data := range d.ram {
+		if address >= offset && address < offset+uint32(len(data)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Device) inFlash(offset uint32, size uint32) bool {
+	return uint64(offset)+uint64(size) <= uint64(len(d.Flash))
+}
+
+// esp8266ROMEraseSize returns the size the ESP8266 ROM actually erases when asked for size bytes
+// at offset: the sectors up to the next 64KB block boundary are erased on top of the requested ones
+func esp8266ROMEraseSize(offset uint32, size uint32) uint32 {
+	sectorCount := (size + flashSectorSize - 1) / flashSectorSize
+	headSectors := 16 - offset/flashSectorSize%16
+	if sectorCount < headSectors {
+		headSectors = sectorCount
+	}
+	return (sectorCount + headSectors) * flashSectorSize
+}
+
+// erase sets all sectors touched by the given range to 0xFF
+func (d *Device) erase(offset uint32, size uint32) {
+	start := offset - offset%flashSectorSize
+	end := (offset + size + flashSectorSize - 1) / flashSectorSize * flashSectorSize
+	if end > uint32(len(d.Flash)) {
+		end = uint32(len(d.Flash))
+	}
+	for i := start; i < end; i++ {
+		d.Flash[i] = 0xFF
+	}
+}
+
+// program writes data like NOR flash does: bits can only be cleared, never set
+func (d *Device) program(offset uint32, data []byte) bool {
+	if !d.inFlash(offset, uint32(len(data))) {
+		return false
+	}
+	for i, b := range data {
+		d.Flash[offset+uint32(i)] &= b
+	}
+	return true
+}
+
+func calculateChecksum(data []byte) uint32 {
+	state := uint32(0xEF)
+	for _, b := range data {
+		state ^= uint32(b)
+	}
+	return state
+}
+
+func (d *Device) respond(opcode common.Opcode, value uint32, data []byte) {
+	d.sendResponse(opcode, value, data, 0, 0)
+}
+
+func (d *Device) fail(opcode common.Opcode, errorCode common.ErrorCode) {
+	d.logger.Printf("Command %s failed: %s", opcode.String(), errorCode.String())
+	d.sendResponse(opcode, 0, nil, 1, errorCode)
+}
+
+func (d *Device) sendResponse(opcode common.Opcode, value uint32, data []byte, status byte, errorCode common.ErrorCode) {
+	statusBytes := make([]byte, romStatusLength)
+	if d.stub {
+		statusBytes = make([]byte, stubStatusLength)
+	} else if d.esp8266 {
+		statusBytes = make([]byte, esp8266ROMStatusLength)
+	}
+	statusBytes[0] = status
+	statusBytes[1] = byte(errorCode)
+
+	response := []byte{byte(common.DirectionResponse), byte(opcode)}
+	response = append(response, common.Uint16ToBytes(uint16(len(data)+len(statusBytes)))...)
+	response = append(response, common.Uint32ToBytes(value)...)
+	response = append(response, data...)
+	response = append(response, statusBytes...)
+	d.send(common.SlipEncode(response))
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"time"
+)
+
+// ServePty exposes the device on a newly allocated pseudo terminal and returns the
+// path of its slave side, which can be opened like any other serial port.
+// Modem control lines do not exist on a pty, so the device stays in download mode and
+// clients have to connect without resetting it.
+func (d *Device) ServePty() (string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return "", err
+	}
+	if err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return "", fmt.Errorf("Failed to unlock pty: %v", err)
+	}
+	ptyNumber, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return "", fmt.Errorf("Failed to get pty number: %v", err)
+	}
+
+	d.mutex.Lock()
+	d.pty = true
+	d.mutex.Unlock()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			if errors.Is(err, unix.EIO) {
+				// nobody has the slave side open, wait for the next client
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			if err != nil {
+				d.logger.Printf("Reading from pty failed: %v", err)
+				return
+			}
+			d.Write(buf[:n])
+		}
+	}()
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, _ := d.Read(buf)
+			if n == 0 {
+				continue
+			}
+			if _, err := master.Write(buf[:n]); err != nil {
+				d.logger.Printf("Writing to pty failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	return fmt.Sprintf("/dev/pts/%d", ptyNumber), nil
+}
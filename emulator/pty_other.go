@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package emulator
+
+import "fmt"
+
+// ServePty is only supported on Linux
+func (d *Device) ServePty() (string, error) {
+	return "", fmt.Errorf("Exposing the emulator on a pty is not supported on this platform")
+}
@@ -0,0 +1,159 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/common"
+	"github.com/fluepke/esptool/image"
+	"io"
+	"net"
+)
+
+const (
+	ChipNameESP8266 = "ESP8266"
+	ChipNameESP32   = "ESP32"
+	ChipNameESP32S2 = "ESP32-S2"
+	ChipNameESP32S3 = "ESP32-S3"
+	ChipNameESP32C2 = "ESP32-C2"
+	ChipNameESP32C3 = "ESP32-C3"
+	ChipNameESP32C6 = "ESP32-C6"
+	ChipNameESP32H2 = "ESP32-H2"
+)
+
+var (
+	// chipMagicValues maps the value of chipDetectMagicReg to the chip family, some families
+	// have different values depending on the ROM revision
+	chipMagicValues = map[uint32]string{
+		0xfff0c101: ChipNameESP8266,
+		0x00f01d83: ChipNameESP32,
+		0x000007c6: ChipNameESP32S2,
+		0x00000009: ChipNameESP32S3,
+		0x6f51306f: ChipNameESP32C2,
+		0x7c41a06f: ChipNameESP32C2,
+		0x6921506f: ChipNameESP32C3,
+		0x1b31506f: ChipNameESP32C3,
+		0x4881606f: ChipNameESP32C3,
+		0x4361606f: ChipNameESP32C3,
+		0x2ce0806f: ChipNameESP32C6,
+		0xd7b73e80: ChipNameESP32H2,
+	}
+
+	// chips holds the implementation of every supported chip family
+	chips = map[string]Chip{
+		ChipNameESP8266: &esp8266Chip{},
+		ChipNameESP32:   &esp32Chip{},
+		ChipNameESP32S2: newESP32S2Chip(),
+		ChipNameESP32S3: newESP32S3Chip(),
+		ChipNameESP32C3: newESP32C3Chip(),
+		ChipNameESP32C6: newESP32C6Chip(),
+	}
+
+	// stubOnlyOpcodes are implemented by the flasher stub, but by no ROM
+	stubOnlyOpcodes = map[common.Opcode]bool{
+		common.OpcodeEraseFlash:    true,
+		common.OpcodeEraseRegion:   true,
+		common.OpcodeReadFlashFast: true,
+		common.OpcodeRunUserCode:   true,
+	}
+)
+
+// Chip covers everything that differs between the chip families speaking the ROM loader
+// protocol. The implementation is chosen by Connect after reading chipDetectMagicReg.
+type Chip interface {
+	// Name returns the chip family, e.g. ESP32-S2
+	Name() string
+	// ImageChipID is the chip ID images built for the family carry in their extended header
+	ImageChipID() image.ChipID
+	// EfuseBase is the address of the eFuse words ReadEfuse indexes: BLK0 on the ESP32, the
+	// block holding MAC address and chip options on later chips
+	EfuseBase() uint
+	// SpiRegisters returns the registers of the SPI peripheral the flash chip is connected to
+	SpiRegisters() *SpiRegisters
+	// FlashWriteSize is the largest FLASH_DATA payload accepted by the ROM, or by the stub if stub is set
+	FlashWriteSize(stub bool) uint32
+	// RAMBlockSize is the largest MEM_DATA payload accepted by the ROM
+	RAMBlockSize() uint32
+	// ROMStatusLength is the number of status bytes the ROM appends to each response
+	ROMStatusLength() int
+	// StubName is the file name of the esptool.py flasher stub for the family
+	StubName() string
+	// AttachSpiFlash makes the flash chip accessible to the loader
+	AttachSpiFlash(rom *ESP32ROM) error
+	// MAC reads the factory MAC address
+	MAC(rom *ESP32ROM) (net.HardwareAddr, error)
+	// Description reads package and revision
+	Description(rom *ESP32ROM) (*ChipDescription, error)
+	// Features reads the capabilities of the chip
+	Features(rom *ESP32ROM) (Features, error)
+	// RomSupports returns false for commands the ROM loader does not implement
+	RomSupports(opcode common.Opcode) bool
+	// SupportsEncryptedFlash is true if FLASH_BEGIN of the ROM takes a fifth word selecting encrypted writes
+	SupportsEncryptedFlash() bool
+	// FlashEraseSize is the erase size to pass to FLASH_BEGIN of the ROM to erase size bytes at offset
+	FlashEraseSize(offset uint32, size uint32) uint32
+	// BootloaderOffset is the flash offset the ROM boots from
+	BootloaderOffset() uint32
+	// PartitionTableOffset is the flash offset of the partition table, 0 if the family has none
+	PartitionTableOffset() uint32
+	// ReadImage parses an image in the format of the family
+	ReadImage(reader io.Reader) (*image.Image, error)
+}
+
+// SpiRegisters are the addresses of the SPI registers used to send commands to the flash chip
+// MosiDlen and MisoDlen are zero if the data lengths are set in Usr1.
+type SpiRegisters struct {
+	Cmd      uint
+	Usr      uint
+	Usr1     uint
+	Usr2     uint
+	MosiDlen uint
+	MisoDlen uint
+	W0       uint
+}
+
+// Chip returns the detected chip family
+func (e *ESP32ROM) Chip() Chip {
+	return e.chip
+}
+
+// usbJTAGSerialChip is implemented by chips with a USB-Serial/JTAG controller, which
+// needs its own reset sequence, see ESP32ROM.Reset
+type usbJTAGSerialChip interface {
+	// usesUSBJTAGSerial returns true if the ROM talks through the USB-Serial/JTAG controller
+	usesUSBJTAGSerial(rom *ESP32ROM) (bool, error)
+}
+
+// readEfuseWords reads the first count words at EfuseBase
+func (e *ESP32ROM) readEfuseWords(count int) ([]uint32, error) {
+	words := make([]uint32, count)
+	for index := range words {
+		value, err := e.readRegisterUint32(e.chip.EfuseBase() + 4*uint(index))
+		if err != nil {
+			return nil, err
+		}
+		words[index] = value
+	}
+	return words, nil
+}
+
+// supports returns true if the running loader implements opcode
+func (e *ESP32ROM) supports(opcode common.Opcode) bool {
+	return e.stubLoaded || e.chip.RomSupports(opcode)
+}
+
+// detectChip reads the chip detect magic value and picks the matching implementation
+func (e *ESP32ROM) detectChip() (Chip, error) {
+	magic, err := e.readRegisterUint32(chipDetectMagicReg)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read chip detect magic value: %v", err)
+	}
+	name, found := chipMagicValues[magic]
+	if !found {
+		return nil, fmt.Errorf("Unknown chip with magic value %08X", magic)
+	}
+	chip, found := chips[name]
+	if !found {
+		return nil, fmt.Errorf("This is an %s, which is not supported", name)
+	}
+	e.logger.Printf("Detected %s", name)
+	return chip, nil
+}
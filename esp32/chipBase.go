@@ -0,0 +1,104 @@
+package esp32
+
+import (
+	"github.com/fluepke/esptool/common"
+	"github.com/fluepke/esptool/image"
+	"io"
+	"net"
+)
+
+// chipBase implements the Chip methods the families after the ESP32 have in common. They embed
+// it and add name, image chip ID, description and features.
+type chipBase struct {
+	efuseBase        uint
+	spiRegBase       uint
+	stubName         string
+	bootloaderOffset uint32
+}
+
+// EfuseBase returns the block holding MAC address, chip revision and package
+func (c *chipBase) EfuseBase() uint {
+	return c.efuseBase
+}
+
+func (c *chipBase) SpiRegisters() *SpiRegisters {
+	return &SpiRegisters{
+		Cmd:      c.spiRegBase + 0x00,
+		Usr:      c.spiRegBase + 0x18,
+		Usr1:     c.spiRegBase + 0x1c,
+		Usr2:     c.spiRegBase + 0x20,
+		MosiDlen: c.spiRegBase + 0x24,
+		MisoDlen: c.spiRegBase + 0x28,
+		W0:       c.spiRegBase + 0x58,
+	}
+}
+
+func (c *chipBase) FlashWriteSize(stub bool) uint32 {
+	if stub {
+		return blockLengthWriteMaxStub
+	}
+	return blockLengthWriteMax
+}
+
+func (c *chipBase) RAMBlockSize() uint32 {
+	return blockLengthRAM
+}
+
+func (c *chipBase) ROMStatusLength() int {
+	return common.StatusLengthROM
+}
+
+func (c *chipBase) StubName() string {
+	return c.stubName
+}
+
+func (c *chipBase) AttachSpiFlash(rom *ESP32ROM) error {
+	_, err := rom.CheckExecuteCommand(
+		common.NewAttachSpiFlashCommand(),
+		rom.defaultTimeout,
+		rom.defaultRetries,
+	)
+	return err
+}
+
+func (c *chipBase) MAC(rom *ESP32ROM) (net.HardwareAddr, error) {
+	return readBlockMAC(rom)
+}
+
+func (c *chipBase) RomSupports(opcode common.Opcode) bool {
+	return !stubOnlyOpcodes[opcode]
+}
+
+func (c *chipBase) SupportsEncryptedFlash() bool {
+	return true
+}
+
+func (c *chipBase) FlashEraseSize(offset uint32, size uint32) uint32 {
+	return size
+}
+
+func (c *chipBase) BootloaderOffset() uint32 {
+	return c.bootloaderOffset
+}
+
+func (c *chipBase) PartitionTableOffset() uint32 {
+	return partitionTableOffset
+}
+
+func (c *chipBase) ReadImage(reader io.Reader) (*image.Image, error) {
+	return image.Read(reader)
+}
+
+// readBlockMAC reads the MAC address from the first two words at EfuseBase, which is where
+// all chips after the ESP32 keep it, most significant byte first
+func readBlockMAC(rom *ESP32ROM) (net.HardwareAddr, error) {
+	words, err := rom.readEfuseWords(2)
+	if err != nil {
+		return nil, err
+	}
+	mac0, mac1 := words[0], words[1]
+	return net.HardwareAddr{
+		byte(mac1 >> 8), byte(mac1),
+		byte(mac0 >> 24), byte(mac0 >> 16), byte(mac0 >> 8), byte(mac0),
+	}, nil
+}
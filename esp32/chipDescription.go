@@ -3,44 +3,22 @@ package esp32
 import "fmt"
 
 type ChipDescription struct {
-	ChipType ChipType
-	Revision byte
+	Chip Chip
+	// Package is the chip model, e.g. ESP32D0WDQ6
+	Package       string
+	Revision      byte
+	MinorRevision byte
 }
 
 func (c *ChipDescription) String() string {
-	return fmt.Sprintf("%s (revision %d)", c.ChipType.String(), c.Revision)
+	return fmt.Sprintf("%s (revision v%d.%d)", c.Package, c.Revision, c.MinorRevision)
 }
 
-func (e *ESP32ROM) GetChipDescription() (*ChipDescription, error) {
-	word3, err := e.ReadEfuse(3)
-	if err != nil {
-		return nil, err
-	}
-	word5, err := e.ReadEfuse(5)
-	if err != nil {
-		return nil, err
-	}
-	apbCtlBase, err := e.ReadRegister(drRegSysconBase + 0x7C)
-
-	revisionBit0 := (word3[1] >> 7) & 0x01
-	revisionBit1 := (word5[2] >> 4) & 0x01
-	revisionBit2 := (apbCtlBase[3] >> 7) & 0x01
-
-	revision := byte(0)
-	if revisionBit0 > 0 {
-		if revisionBit1 > 0 {
-			if revisionBit2 > 0 {
-				revision = 3
-			} else {
-				revision = 2
-			}
-		} else {
-			revision = 1
-		}
-	}
+// FullRevision returns the revision as major * 100 + minor, like the revisions in image headers
+func (c *ChipDescription) FullRevision() uint16 {
+	return uint16(c.Revision)*100 + uint16(c.MinorRevision)
+}
 
-	return &ChipDescription{
-		ChipType: ChipType((word3[1] >> 1) & 0x07),
-		Revision: revision,
-	}, nil
+func (e *ESP32ROM) GetChipDescription() (*ChipDescription, error) {
+	return e.chip.Description(e)
 }
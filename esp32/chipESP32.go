@@ -0,0 +1,188 @@
+package esp32
+
+import (
+	"github.com/fluepke/esptool/common"
+	"github.com/fluepke/esptool/image"
+	"io"
+	"net"
+)
+
+// esp32Chip is the original ESP32
+type esp32Chip struct{}
+
+func (c *esp32Chip) Name() string {
+	return ChipNameESP32
+}
+
+func (c *esp32Chip) ImageChipID() image.ChipID {
+	return image.ChipIDESP32
+}
+
+func (c *esp32Chip) EfuseBase() uint {
+	return efuseRegBase
+}
+
+func (c *esp32Chip) SpiRegisters() *SpiRegisters {
+	return &SpiRegisters{
+		Cmd:      spiCmdReg,
+		Usr:      spiUsrReg,
+		Usr1:     spiUsr1Reg,
+		Usr2:     spiUsr2Reg,
+		MosiDlen: spiMosiDlenReg,
+		MisoDlen: spiMisoDlenReg,
+		W0:       spiW0Reg,
+	}
+}
+
+func (c *esp32Chip) FlashWriteSize(stub bool) uint32 {
+	if stub {
+		return blockLengthWriteMaxStub
+	}
+	return blockLengthWriteMax
+}
+
+func (c *esp32Chip) RAMBlockSize() uint32 {
+	return blockLengthRAM
+}
+
+func (c *esp32Chip) ROMStatusLength() int {
+	return common.StatusLengthROM
+}
+
+func (c *esp32Chip) StubName() string {
+	return "stub_flasher_32.json"
+}
+
+func (c *esp32Chip) AttachSpiFlash(rom *ESP32ROM) error {
+	_, err := rom.CheckExecuteCommand(
+		common.NewAttachSpiFlashCommand(),
+		rom.defaultTimeout,
+		rom.defaultRetries,
+	)
+	return err
+}
+
+func (c *esp32Chip) MAC(rom *ESP32ROM) (net.HardwareAddr, error) {
+	buf := make([]byte, 6)
+	mac0, err := rom.ReadEfuse(2)
+	if err != nil {
+		return nil, err
+	}
+	mac1, err := rom.ReadEfuse(1)
+	if err != nil {
+		return nil, err
+	}
+	buf[0] = mac0[1]
+	buf[1] = mac0[0]
+	buf[2] = mac1[3]
+	buf[3] = mac1[2]
+	buf[4] = mac1[1]
+	buf[5] = mac1[0]
+	return net.HardwareAddr(buf), nil
+}
+
+func (c *esp32Chip) Description(rom *ESP32ROM) (*ChipDescription, error) {
+	word3, err := rom.ReadEfuse(3)
+	if err != nil {
+		return nil, err
+	}
+	word5, err := rom.ReadEfuse(5)
+	if err != nil {
+		return nil, err
+	}
+	apbCtlBase, err := rom.ReadRegister(drRegSysconBase + 0x7C)
+	if err != nil {
+		return nil, err
+	}
+
+	revisionBit0 := (word3[1] >> 7) & 0x01
+	revisionBit1 := (word5[2] >> 4) & 0x01
+	revisionBit2 := (apbCtlBase[3] >> 7) & 0x01
+
+	revision := byte(0)
+	if revisionBit0 > 0 {
+		if revisionBit1 > 0 {
+			if revisionBit2 > 0 {
+				revision = 3
+			} else {
+				revision = 2
+			}
+		} else {
+			revision = 1
+		}
+	}
+
+	return &ChipDescription{
+		Chip:          c,
+		Package:       ChipType((word3[1] >> 1) & 0x07).String(),
+		Revision:      revision,
+		MinorRevision: word5[3] & 0x03, // WAFER_VERSION_MINOR
+	}, nil
+}
+
+func (c *esp32Chip) Features(rom *ESP32ROM) (Features, error) {
+	features := Features{
+		WiFi: true,
+	}
+
+	word3, err := rom.ReadEfuse(3)
+	if err != nil {
+		return features, err
+	}
+
+	features[Bluetooth] = word3[0]&(1<<1) == 0
+	// CHIP_VER_DIS_APP_CPU
+	features[DualCore] = word3[0]&(1<<0) == 0
+	features[SingleCore] = !features[DualCore]
+	if word3[1]&(1<<5) > 0 {
+		features[Clock160MHz] = word3[1]&(1<<4) > 0
+		features[Clock240MHz] = !features[Clock160MHz]
+	}
+
+	pkgVersion := (word3[1] >> 1) & 0x07
+	features[EmbeddedFlash] = pkgVersion == 2 || pkgVersion == 4 || pkgVersion == 5
+
+	word4, err := rom.ReadEfuse(4)
+	if err != nil {
+		return features, err
+	}
+
+	features[VRefCalibrationEFuse] = word4[1]&0x1F > 0
+	features[BLK3Reserved] = word3[1]>>6&0x01 > 0
+
+	word6, err := rom.ReadEfuse(6)
+	if err != nil {
+		return features, err
+	}
+
+	features[CodingSchemeNone] = word6[0]&0x03 == 0
+	features[CodingScheme3_4] = word6[0]&0x03 == 1
+	features[CodingSchemeRepeat] = word6[0]&0x03 == 2
+	features[CodingSchemeInvalid] = word6[0]&0x03 == 3
+
+	return features, nil
+}
+
+func (c *esp32Chip) RomSupports(opcode common.Opcode) bool {
+	return !stubOnlyOpcodes[opcode]
+}
+
+func (c *esp32Chip) SupportsEncryptedFlash() bool {
+	return false
+}
+
+func (c *esp32Chip) FlashEraseSize(offset uint32, size uint32) uint32 {
+	return size
+}
+
+func (c *esp32Chip) BootloaderOffset() uint32 {
+	return 0x1000
+}
+
+func (c *esp32Chip) PartitionTableOffset() uint32 {
+	return partitionTableOffset
+}
+
+func (c *esp32Chip) ReadImage(reader io.Reader) (*image.Image, error) {
+	return image.Read(reader)
+}
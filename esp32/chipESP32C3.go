@@ -0,0 +1,81 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/image"
+)
+
+const (
+	esp32C3EfuseBlock1    uint = 0x60008844
+	esp32C3SpiRegBase     uint = 0x60002000 // SPI1, which is connected to the flash chip
+	esp32C3UartDevBufNo   uint = 0x3fcdf07c // the console the ROM talks on
+	esp32C3UartDevUSBJTAG      = 3
+)
+
+var esp32C3Packages = map[uint32]string{
+	0: "ESP32-C3 (QFN32)",
+	1: "ESP8685 (QFN28)",
+	2: "ESP32-C3 AZ (QFN32)",
+	3: "ESP8686 (QFN24)",
+}
+
+// esp32C3Chip is the single core RISC-V ESP32-C3 with BLE and USB-Serial/JTAG
+type esp32C3Chip struct {
+	chipBase
+}
+
+func newESP32C3Chip() *esp32C3Chip {
+	return &esp32C3Chip{chipBase{
+		efuseBase:        esp32C3EfuseBlock1,
+		spiRegBase:       esp32C3SpiRegBase,
+		stubName:         "stub_flasher_32c3.json",
+		bootloaderOffset: 0,
+	}}
+}
+
+func (c *esp32C3Chip) Name() string {
+	return ChipNameESP32C3
+}
+
+func (c *esp32C3Chip) ImageChipID() image.ChipID {
+	return image.ChipIDESP32C3
+}
+
+func (c *esp32C3Chip) Description(rom *ESP32ROM) (*ChipDescription, error) {
+	words, err := rom.readEfuseWords(6)
+	if err != nil {
+		return nil, err
+	}
+	pkgVersion := words[3] >> 21 & 0x07
+	name, found := esp32C3Packages[pkgVersion]
+	if !found {
+		name = fmt.Sprintf("unknown ESP32-C3 (package %d)", pkgVersion)
+	}
+	return &ChipDescription{
+		Chip:          c,
+		Package:       name,
+		Revision:      byte(words[5] >> 24 & 0x03),
+		MinorRevision: byte(words[5]>>23&0x01)<<3 | byte(words[3]>>18&0x07),
+	}, nil
+}
+
+func (c *esp32C3Chip) Features(rom *ESP32ROM) (Features, error) {
+	features := Features{
+		WiFi:          true,
+		BluetoothLE:   true,
+		SingleCore:    true,
+		Clock160MHz:   true,
+		USBSerialJTAG: true,
+	}
+	words, err := rom.readEfuseWords(4)
+	if err != nil {
+		return features, err
+	}
+	features[EmbeddedFlash] = words[3]>>27&0x07 != 0
+	return features, nil
+}
+
+func (c *esp32C3Chip) usesUSBJTAGSerial(rom *ESP32ROM) (bool, error) {
+	console, err := rom.readRegisterUint32(esp32C3UartDevBufNo)
+	return console&0xFF == esp32C3UartDevUSBJTAG, err
+}
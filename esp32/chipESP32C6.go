@@ -0,0 +1,82 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/image"
+)
+
+const (
+	esp32C6EfuseBlock1     uint = 0x600b0844
+	esp32C6SpiRegBase      uint = 0x60003000 // SPI1, which is connected to the flash chip
+	esp32C6UartDevBufNo    uint = 0x4087f580 // the console the ROM talks on
+	esp32C6UartDevUSBJTAG       = 3
+	esp32C6PackageQFN40         = 0
+	esp32C6PackageFH4QFN32      = 1
+)
+
+var esp32C6Packages = map[uint32]string{
+	esp32C6PackageQFN40:    "ESP32-C6 (QFN40)",
+	esp32C6PackageFH4QFN32: "ESP32-C6FH4 (QFN32)",
+}
+
+// esp32C6Chip is the RISC-V ESP32-C6 with WiFi 6, BLE, IEEE 802.15.4 and USB-Serial/JTAG
+type esp32C6Chip struct {
+	chipBase
+}
+
+func newESP32C6Chip() *esp32C6Chip {
+	return &esp32C6Chip{chipBase{
+		efuseBase:        esp32C6EfuseBlock1,
+		spiRegBase:       esp32C6SpiRegBase,
+		stubName:         "stub_flasher_32c6.json",
+		bootloaderOffset: 0,
+	}}
+}
+
+func (c *esp32C6Chip) Name() string {
+	return ChipNameESP32C6
+}
+
+func (c *esp32C6Chip) ImageChipID() image.ChipID {
+	return image.ChipIDESP32C6
+}
+
+func (c *esp32C6Chip) Description(rom *ESP32ROM) (*ChipDescription, error) {
+	words, err := rom.readEfuseWords(4)
+	if err != nil {
+		return nil, err
+	}
+	pkgVersion := words[3] >> 24 & 0x07
+	name, found := esp32C6Packages[pkgVersion]
+	if !found {
+		name = fmt.Sprintf("unknown ESP32-C6 (package %d)", pkgVersion)
+	}
+	return &ChipDescription{
+		Chip:          c,
+		Package:       name,
+		Revision:      byte(words[3] >> 22 & 0x03),
+		MinorRevision: byte(words[3] >> 18 & 0x0F),
+	}, nil
+}
+
+func (c *esp32C6Chip) Features(rom *ESP32ROM) (Features, error) {
+	features := Features{
+		WiFi:          true,
+		BluetoothLE:   true,
+		IEEE802154:    true,
+		SingleCore:    true,
+		Clock160MHz:   true,
+		USBSerialJTAG: true,
+	}
+	words, err := rom.readEfuseWords(4)
+	if err != nil {
+		return features, err
+	}
+	features[EmbeddedFlash] = words[3]>>24&0x07 == esp32C6PackageFH4QFN32
+	return features, nil
+}
+
+func (c *esp32C6Chip) usesUSBJTAGSerial(rom *ESP32ROM) (bool, error) {
+	console, err := rom.readRegisterUint32(esp32C6UartDevBufNo)
+	return console&0xFF == esp32C6UartDevUSBJTAG, err
+}
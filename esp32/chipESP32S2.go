@@ -0,0 +1,79 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/image"
+)
+
+const (
+	macEfuseReg       uint = 0x3f41A044 // ESP32-S2 has special block for MAC efuses
+	esp32S2SpiRegBase uint = 0x3f402000 // SPI1, which is connected to the flash chip
+)
+
+var (
+	// esp32S2Packages is indexed by the embedded flash size plus 100 times the embedded PSRAM size
+	esp32S2Packages = map[uint32]string{
+		0:   "ESP32-S2",
+		1:   "ESP32-S2FH2",
+		2:   "ESP32-S2FH4",
+		100: "ESP32-S2R2",
+		102: "ESP32-S2FNR2",
+	}
+)
+
+// esp32S2Chip is the single core ESP32-S2 with USB-OTG
+type esp32S2Chip struct {
+	chipBase
+}
+
+func newESP32S2Chip() *esp32S2Chip {
+	return &esp32S2Chip{chipBase{
+		efuseBase:        macEfuseReg,
+		spiRegBase:       esp32S2SpiRegBase,
+		stubName:         "stub_flasher_32s2.json",
+		bootloaderOffset: 0x1000,
+	}}
+}
+
+func (c *esp32S2Chip) Name() string {
+	return ChipNameESP32S2
+}
+
+func (c *esp32S2Chip) ImageChipID() image.ChipID {
+	return image.ChipIDESP32S2
+}
+
+func (c *esp32S2Chip) Description(rom *ESP32ROM) (*ChipDescription, error) {
+	words, err := rom.readEfuseWords(5)
+	if err != nil {
+		return nil, err
+	}
+	flashCap := words[3] >> 21 & 0x0F
+	psramCap := words[3] >> 28 & 0x0F
+	name, found := esp32S2Packages[flashCap+100*psramCap]
+	if !found {
+		name = fmt.Sprintf("unknown ESP32-S2 (flash %d, PSRAM %d)", flashCap, psramCap)
+	}
+	return &ChipDescription{
+		Chip:          c,
+		Package:       name,
+		Revision:      byte(words[3] >> 18 & 0x03),
+		MinorRevision: byte(words[3]>>20&0x01)<<3 | byte(words[4]>>4&0x07),
+	}, nil
+}
+
+func (c *esp32S2Chip) Features(rom *ESP32ROM) (Features, error) {
+	features := Features{
+		WiFi:        true,
+		SingleCore:  true,
+		Clock240MHz: true,
+		USBOTG:      true,
+	}
+	words, err := rom.readEfuseWords(4)
+	if err != nil {
+		return features, err
+	}
+	features[EmbeddedFlash] = words[3]>>21&0x0F != 0
+	features[EmbeddedPSRAM] = words[3]>>28&0x0F != 0
+	return features, nil
+}
@@ -0,0 +1,83 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/image"
+)
+
+const (
+	esp32S3EfuseBlock1      uint = 0x60007044
+	esp32S3SpiRegBase       uint = 0x60002000 // SPI1, which is connected to the flash chip
+	esp32S3UartDevBufNo     uint = 0x3fcef14c // the console the ROM talks on
+	esp32S3UartDevUSBJTAG        = 4
+	esp32S3PackageQFN56          = 0
+	esp32S3PackagePicoLGA56      = 1
+)
+
+var esp32S3Packages = map[uint32]string{
+	esp32S3PackageQFN56:     "ESP32-S3 (QFN56)",
+	esp32S3PackagePicoLGA56: "ESP32-S3-PICO-1 (LGA56)",
+}
+
+// esp32S3Chip is the dual core ESP32-S3 with BLE, USB-OTG and USB-Serial/JTAG
+type esp32S3Chip struct {
+	chipBase
+}
+
+func newESP32S3Chip() *esp32S3Chip {
+	return &esp32S3Chip{chipBase{
+		efuseBase:        esp32S3EfuseBlock1,
+		spiRegBase:       esp32S3SpiRegBase,
+		stubName:         "stub_flasher_32s3.json",
+		bootloaderOffset: 0,
+	}}
+}
+
+func (c *esp32S3Chip) Name() string {
+	return ChipNameESP32S3
+}
+
+func (c *esp32S3Chip) ImageChipID() image.ChipID {
+	return image.ChipIDESP32S3
+}
+
+func (c *esp32S3Chip) Description(rom *ESP32ROM) (*ChipDescription, error) {
+	words, err := rom.readEfuseWords(6)
+	if err != nil {
+		return nil, err
+	}
+	pkgVersion := words[3] >> 21 & 0x07
+	name, found := esp32S3Packages[pkgVersion]
+	if !found {
+		name = fmt.Sprintf("unknown ESP32-S3 (package %d)", pkgVersion)
+	}
+	return &ChipDescription{
+		Chip:          c,
+		Package:       name,
+		Revision:      byte(words[5] >> 24 & 0x03),
+		MinorRevision: byte(words[5]>>23&0x01)<<3 | byte(words[3]>>18&0x07),
+	}, nil
+}
+
+func (c *esp32S3Chip) Features(rom *ESP32ROM) (Features, error) {
+	features := Features{
+		WiFi:          true,
+		BluetoothLE:   true,
+		DualCore:      true,
+		Clock240MHz:   true,
+		USBOTG:        true,
+		USBSerialJTAG: true,
+	}
+	words, err := rom.readEfuseWords(6)
+	if err != nil {
+		return features, err
+	}
+	features[EmbeddedFlash] = words[3]>>27&0x07 != 0
+	features[EmbeddedPSRAM] = words[4]>>3&0x03 != 0 || words[5]>>19&0x01 != 0
+	return features, nil
+}
+
+func (c *esp32S3Chip) usesUSBJTAGSerial(rom *ESP32ROM) (bool, error) {
+	console, err := rom.readRegisterUint32(esp32S3UartDevBufNo)
+	return console&0xFF == esp32S3UartDevUSBJTAG, err
+}
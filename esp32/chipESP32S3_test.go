@@ -0,0 +1,22 @@
+package esp32
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestESP32S3WriteFlash(t *testing.T) {
+	e, device := newEmulatedChip(t, 0x00000009, map[uint32]uint32{uint32(esp32S3UartDevBufNo): esp32S3UartDevUSBJTAG})
+	if !e.USBJTAGSerial {
+		t.Errorf("Expected the USB-Serial/JTAG console to be detected")
+	}
+
+	// FLASH_BEGIN carries the encrypted flag on the S3 ROM
+	data := bytes.Repeat([]byte{0xAB, 0xCD}, 0x900)
+	if err := e.WriteFlash(0x10000, data, true, true, true); err != nil {
+		t.Fatalf("WriteFlash errored with: %v", err)
+	}
+	if !bytes.Equal(device.Flash[0x10000:0x10000+len(data)], data) {
+		t.Errorf("Written data does not match")
+	}
+}
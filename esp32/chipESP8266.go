@@ -0,0 +1,195 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/common"
+	"github.com/fluepke/esptool/image"
+	"io"
+	"net"
+)
+
+const (
+	esp8266EfuseBase       uint = 0x3ff00050 // OTP MAC0 to MAC3
+	esp8266SpiRegBase      uint = 0x60000200 // SPI0, which is connected to the flash chip
+	esp8266SectorsPerBlock      = 16
+)
+
+var (
+	// esp8266MissingOpcodes are not implemented by the ESP8266 ROM, only by the stub
+	esp8266MissingOpcodes = map[common.Opcode]bool{
+		common.OpcodeSpiAttachFlash: true,
+		common.OpcodeReadFlash:      true,
+		common.OpcodeChangeBaudrate: true,
+		common.OpcodeFlashDeflBegin: true,
+		common.OpcodeFlashDeflData:  true,
+		common.OpcodeFlashDeflEnd:   true,
+		common.OpcodeSpiFlashMd5:    true,
+	}
+
+	// esp8266OUIs are the OUIs selected by byte 2 of MAC1 if MAC3 is empty
+	esp8266OUIs = map[byte][]byte{
+		0: {0x18, 0xFE, 0x34},
+		1: {0xAC, 0xD0, 0x74},
+	}
+)
+
+// esp8266Chip is the ESP8266EX and the ESP8285 with embedded flash. It has no eFuse
+// controller, but four OTP words holding MAC address and chip options.
+type esp8266Chip struct{}
+
+func (c *esp8266Chip) Name() string {
+	return ChipNameESP8266
+}
+
+func (c *esp8266Chip) ImageChipID() image.ChipID {
+	return image.ChipIDESP8266
+}
+
+func (c *esp8266Chip) EfuseBase() uint {
+	return esp8266EfuseBase
+}
+
+func (c *esp8266Chip) SpiRegisters() *SpiRegisters {
+	return &SpiRegisters{
+		Cmd:  esp8266SpiRegBase + 0x00,
+		Usr:  esp8266SpiRegBase + 0x1c,
+		Usr1: esp8266SpiRegBase + 0x20,
+		Usr2: esp8266SpiRegBase + 0x24,
+		W0:   esp8266SpiRegBase + 0x40,
+	}
+}
+
+func (c *esp8266Chip) FlashWriteSize(stub bool) uint32 {
+	if stub {
+		return blockLengthWriteMaxStub
+	}
+	return blockLengthWriteMax
+}
+
+func (c *esp8266Chip) RAMBlockSize() uint32 {
+	return blockLengthRAM
+}
+
+func (c *esp8266Chip) ROMStatusLength() int {
+	return common.StatusLengthROMESP8266
+}
+
+func (c *esp8266Chip) StubName() string {
+	return "stub_flasher_8266.json"
+}
+
+// AttachSpiFlash uses an empty FLASH_BEGIN in the ROM, which has no SPI_ATTACH command
+func (c *esp8266Chip) AttachSpiFlash(rom *ESP32ROM) error {
+	command := common.NewAttachSpiFlashCommand()
+	if !rom.stubLoaded {
+		command = common.NewBeginFlashCommand(0, 0, c.FlashWriteSize(false), 0)
+	}
+	_, err := rom.CheckExecuteCommand(command, rom.defaultTimeout, rom.defaultRetries)
+	return err
+}
+
+// readOTP returns the words MAC0 to MAC3
+func (c *esp8266Chip) readOTP(rom *ESP32ROM) ([4]uint32, error) {
+	var words [4]uint32
+	for index := range words {
+		value, err := rom.readRegisterUint32(c.EfuseBase() + 4*uint(index))
+		if err != nil {
+			return words, err
+		}
+		words[index] = value
+	}
+	return words, nil
+}
+
+func (c *esp8266Chip) MAC(rom *ESP32ROM) (net.HardwareAddr, error) {
+	otp, err := c.readOTP(rom)
+	if err != nil {
+		return nil, err
+	}
+	mac0, mac1, mac3 := otp[0], otp[1], otp[3]
+
+	var oui []byte
+	if mac3 != 0 {
+		oui = []byte{byte(mac3 >> 16), byte(mac3 >> 8), byte(mac3)}
+	} else {
+		var found bool
+		oui, found = esp8266OUIs[byte(mac1>>16)]
+		if !found {
+			return nil, fmt.Errorf("Unknown OUI %02X in OTP word MAC1 %08X", byte(mac1>>16), mac1)
+		}
+	}
+	return net.HardwareAddr(append(oui, byte(mac1>>8), byte(mac1), byte(mac0>>24))), nil
+}
+
+// isESP8285 checks the OTP bits marking chips with embedded flash
+func (c *esp8266Chip) isESP8285(rom *ESP32ROM) (bool, error) {
+	otp, err := c.readOTP(rom)
+	if err != nil {
+		return false, err
+	}
+	return otp[0]&(1<<4) != 0 || otp[2]&(1<<16) != 0, nil
+}
+
+func (c *esp8266Chip) Description(rom *ESP32ROM) (*ChipDescription, error) {
+	esp8285, err := c.isESP8285(rom)
+	if err != nil {
+		return nil, err
+	}
+	description := &ChipDescription{
+		Chip:    c,
+		Package: "ESP8266EX",
+	}
+	if esp8285 {
+		description.Package = "ESP8285"
+	}
+	return description, nil
+}
+
+func (c *esp8266Chip) Features(rom *ESP32ROM) (Features, error) {
+	features := Features{
+		WiFi: true,
+	}
+	esp8285, err := c.isESP8285(rom)
+	if err != nil {
+		return features, err
+	}
+	features[EmbeddedFlash] = esp8285
+	return features, nil
+}
+
+func (c *esp8266Chip) RomSupports(opcode common.Opcode) bool {
+	return !stubOnlyOpcodes[opcode] && !esp8266MissingOpcodes[opcode]
+}
+
+func (c *esp8266Chip) SupportsEncryptedFlash() bool {
+	return false
+}
+
+// FlashEraseSize compensates a bug in the ROM: FLASH_BEGIN erases the sectors up to the next
+// 64KB block boundary twice, once sector by sector and once more in the count of the remainder.
+func (c *esp8266Chip) FlashEraseSize(offset uint32, size uint32) uint32 {
+	sectorCount := (size + flashSectorSize - 1) / flashSectorSize
+	startSector := offset / flashSectorSize
+
+	headSectors := esp8266SectorsPerBlock - startSector%esp8266SectorsPerBlock
+	if sectorCount < headSectors {
+		headSectors = sectorCount
+	}
+	if sectorCount < 2*headSectors {
+		return (sectorCount + 1) / 2 * flashSectorSize
+	}
+	return (sectorCount - headSectors) * flashSectorSize
+}
+
+func (c *esp8266Chip) BootloaderOffset() uint32 {
+	return 0
+}
+
+// PartitionTableOffset is 0, the ESP8266 SDKs use fixed flash layouts
+func (c *esp8266Chip) PartitionTableOffset() uint32 {
+	return 0
+}
+
+func (c *esp8266Chip) ReadImage(reader io.Reader) (*image.Image, error) {
+	return image.ReadESP8266(reader)
+}
@@ -0,0 +1,80 @@
+package esp32
+
+import (
+	"bytes"
+	"github.com/fluepke/esptool/emulator"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+func newEmulatedESP8266(t *testing.T) (*ESP32ROM, *emulator.Device) {
+	device := emulator.NewESP8266Device(4*1024*1024, nil)
+	e := NewESP32ROM(device, log.New(ioutil.Discard, "", 0))
+	if err := e.Connect(3); err != nil {
+		t.Fatalf("Connect errored with: %v", err)
+	}
+	return e, device
+}
+
+func TestESP8266FlashLayout(t *testing.T) {
+	e, _ := newEmulatedESP8266(t)
+	flashID, err := e.GetFlashID()
+	if err != nil {
+		t.Fatalf("GetFlashID errored with: %v", err)
+	}
+	if flashID.Size != 4*1024*1024 {
+		t.Errorf("Expected a 4MB flash, received %s", flashID.String())
+	}
+	if _, err = e.ReadPartitionList(); err == nil {
+		t.Errorf("Expected ReadPartitionList to fail on a chip without partition table")
+	}
+}
+
+func TestESP8266FlashEraseSize(t *testing.T) {
+	chip := &esp8266Chip{}
+	for _, test := range []struct {
+		offset   uint32
+		size     uint32
+		expected uint32
+	}{
+		{0x0000, 0x1000, 0x1000},
+		{0x0000, 0x400000, 0x3F0000},
+		{0x8000, 0x14000, 0xC000},
+		{0x8000, 0x3000, 0x2000},
+		{0xF000, 0x3000, 0x2000},
+	} {
+		if size := chip.FlashEraseSize(test.offset, test.size); size != test.expected {
+			t.Errorf("Expected erase size %X for %X bytes at %X, got %X", test.expected, test.size, test.offset, size)
+		}
+	}
+}
+
+func TestESP8266WriteFlashROM(t *testing.T) {
+	e, device := newEmulatedESP8266(t)
+	if err := e.ChangeBaudrate(921600); err != nil || device.Baudrate != 115200 {
+		t.Errorf("Expected the ROM to stay at 115200, got %d: %v", device.Baudrate, err)
+	}
+
+	// the ROM would erase another 8 sectors without the erase size workaround
+	sentinel := uint32(0x8000 + 0x14000)
+	device.Flash[sentinel] = 0x00
+	data := bytes.Repeat([]byte{0x12, 0x34, 0x56}, 0x14000/3)
+	if err := e.WriteFlash(0x8000, data, true, true, false); err == nil || !strings.Contains(err.Error(), "stub_flasher_8266.json") {
+		t.Errorf("Expected verified writes without stub to ask for the stub, got: %v", err)
+	}
+	if err := e.WriteFlash(0x8000, data, true, false, false); err != nil {
+		t.Fatalf("WriteFlash errored with: %v", err)
+	}
+	if device.Flash[sentinel] != 0x00 {
+		t.Errorf("Flash beyond the written region got erased")
+	}
+	if !bytes.Equal(device.Flash[0x8000:0x8000+len(data)], data) {
+		t.Errorf("Written data does not match")
+	}
+	_, err := e.ReadFlash(0x8000, 0x100)
+	if err == nil || !strings.Contains(err.Error(), "stub_flasher_8266.json") {
+		t.Errorf("Expected reading flash without stub to ask for the stub, got: %v", err)
+	}
+}
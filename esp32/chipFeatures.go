@@ -19,6 +19,11 @@ const (
 	CodingScheme3_4
 	CodingSchemeRepeat
 	CodingSchemeInvalid
+	EmbeddedPSRAM
+	BluetoothLE
+	USBOTG
+	USBSerialJTAG
+	IEEE802154
 )
 
 func (f Feature) String() string {
@@ -36,6 +41,11 @@ func (f Feature) String() string {
 		CodingScheme3_4:      "Coding Scheme 3/4",
 		CodingSchemeRepeat:   "Coding Scheme Repeat (UNSUPPORTED)",
 		CodingSchemeInvalid:  "Coding Scheme Invalid",
+		EmbeddedPSRAM:        "Embedded PSRAM",
+		BluetoothLE:          "BLE",
+		USBOTG:               "USB-OTG",
+		USBSerialJTAG:        "USB-Serial/JTAG",
+		IEEE802154:           "IEEE 802.15.4",
 	}[f]
 }
 
@@ -50,44 +60,7 @@ func (f Features) String() string {
 	return strings.Join(res, ", ")
 }
 
+// GetFeatures reads the capabilities of the chip
 func (e *ESP32ROM) GetFeatures() (Features, error) {
-	features := Features{
-		WiFi: true,
-	}
-
-	word3, err := e.ReadEfuse(3)
-	if err != nil {
-		return features, err
-	}
-
-	features[Bluetooth] = word3[0]&(1<<1) == 0
-	features[DualCore] = word3[0]&(1<<0) > 0
-	features[SingleCore] = !features[DualCore]
-	if word3[1]&(1<<5) > 0 {
-		features[Clock160MHz] = word3[1]&(1<<4) > 0
-		features[Clock240MHz] = !features[Clock160MHz]
-	}
-
-	pkgVersion := (word3[1] >> 1) & 0x07
-	features[EmbeddedFlash] = pkgVersion == 2 || pkgVersion == 4 || pkgVersion == 5
-
-	word4, err := e.ReadEfuse(4)
-	if err != nil {
-		return features, err
-	}
-
-	features[VRefCalibrationEFuse] = word4[1]&0x1F > 0
-	features[BLK3Reserved] = word4[1]>>6&0x01 > 0
-
-	word6, err := e.ReadEfuse(6)
-	if err != nil {
-		return features, err
-	}
-
-	features[CodingSchemeNone] = word6[0]&0x03 == 0
-	features[CodingScheme3_4] = word6[0]&0x03 == 1
-	features[CodingSchemeRepeat] = word6[0]&0x03 == 2
-	features[CodingSchemeInvalid] = word6[0]&0x03 == 3
-
-	return features, nil
+	return e.chip.Features(e)
 }
@@ -0,0 +1,38 @@
+package esp32
+
+import (
+	"testing"
+)
+
+func TestGetFeaturesCoresAndBLK3(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+
+	features, err := e.GetFeatures()
+	if err != nil {
+		t.Fatalf("GetFeatures errored with: %v", err)
+	}
+	if !features[DualCore] || features[SingleCore] || features[BLK3Reserved] {
+		t.Errorf("Expected a dual core chip without BLK3_PART_RESERVE, got %s", features.String())
+	}
+
+	// CHIP_VER_DIS_APP_CPU and BLK3_PART_RESERVE
+	device.SetEfuse(3, 0x00008000|1<<0|1<<14)
+	features, err = e.GetFeatures()
+	if err != nil {
+		t.Fatalf("GetFeatures errored with: %v", err)
+	}
+	if features[DualCore] || !features[SingleCore] || !features[BLK3Reserved] {
+		t.Errorf("Expected a single core chip with BLK3_PART_RESERVE, got %s", features.String())
+	}
+
+	// bit 14 of word 4 belongs to the VDD_SDIO settings
+	device.SetEfuse(3, 0x00008000)
+	device.SetEfuse(4, 0x00004800)
+	features, err = e.GetFeatures()
+	if err != nil {
+		t.Fatalf("GetFeatures errored with: %v", err)
+	}
+	if features[BLK3Reserved] {
+		t.Errorf("Expected BLK3_PART_RESERVE to be read from word 3, got %s", features.String())
+	}
+}
@@ -0,0 +1,188 @@
+package esp32
+
+import (
+	"github.com/fluepke/esptool/emulator"
+	"github.com/fluepke/esptool/image"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+// newEmulatedChip connects to an emulated chip answering magic, registers are set on top of the defaults
+func newEmulatedChip(t *testing.T, magic uint32, registers map[uint32]uint32) (*ESP32ROM, *emulator.Device) {
+	device := emulator.NewDevice(4*1024*1024, nil)
+	if chipMagicValues[magic] == ChipNameESP8266 {
+		device = emulator.NewESP8266Device(4*1024*1024, nil)
+	}
+	device.Registers[uint32(chipDetectMagicReg)] = magic
+	for register, value := range registers {
+		device.Registers[register] = value
+	}
+	e := NewESP32ROM(device, log.New(ioutil.Discard, "", 0))
+	if err := e.Connect(3); err != nil {
+		t.Fatalf("Connect errored with: %v", err)
+	}
+	return e, device
+}
+
+// efuseWords returns the registers holding words at the eFuse block starting at base
+func efuseWords(base uint, words ...uint32) map[uint32]uint32 {
+	registers := map[uint32]uint32{}
+	for index, word := range words {
+		registers[uint32(base)+4*uint32(index)] = word
+	}
+	return registers
+}
+
+// withRegister adds a register to registers
+func withRegister(registers map[uint32]uint32, register uint, value uint32) map[uint32]uint32 {
+	registers[uint32(register)] = value
+	return registers
+}
+
+func TestChipFamilies(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		magic      uint32
+		registers  map[uint32]uint32
+		mac        string
+		pkg        string
+		revision   string
+		features   []Feature
+		bootOffset uint32
+		usbJTAG    bool
+	}{
+		{
+			name:       ChipNameESP8266,
+			magic:      0xfff0c101,
+			mac:        "18:fe:34:12:34:56",
+			pkg:        "ESP8266EX",
+			revision:   "v0.0",
+			features:   []Feature{WiFi},
+			bootOffset: 0,
+		},
+		{
+			name:       ChipNameESP8266,
+			magic:      0xfff0c101,
+			registers:  efuseWords(esp8266EfuseBase, 0x56000000, 0x00001234, 1<<16, 0x00ACD074),
+			mac:        "ac:d0:74:12:34:56",
+			pkg:        "ESP8285",
+			revision:   "v0.0",
+			features:   []Feature{WiFi, EmbeddedFlash},
+			bootOffset: 0,
+		},
+		{
+			name:       ChipNameESP32,
+			magic:      0x00f01d83,
+			mac:        "24:6f:28:92:ef:20",
+			pkg:        "ESP32D0WDQ6",
+			revision:   "v1.0",
+			features:   []Feature{WiFi, Bluetooth, DualCore, VRefCalibrationEFuse, CodingSchemeNone},
+			bootOffset: 0x1000,
+		},
+		{
+			name:       ChipNameESP32S2,
+			magic:      0x000007c6,
+			registers:  efuseWords(macEfuseReg, 0xa1001122, 0x00007cdf, 0, 0x00440000, 0),
+			mac:        "7c:df:a1:00:11:22",
+			pkg:        "ESP32-S2FH4",
+			revision:   "v1.0",
+			features:   []Feature{WiFi, USBOTG, EmbeddedFlash},
+			bootOffset: 0x1000,
+		},
+		{
+			name:       ChipNameESP32S3,
+			magic:      0x00000009,
+			registers:  efuseWords(esp32S3EfuseBlock1, 0xa1001122, 0x00007cdf, 0, 0x10280000, 0x00000008, 0),
+			mac:        "7c:df:a1:00:11:22",
+			pkg:        "ESP32-S3-PICO-1 (LGA56)",
+			revision:   "v0.2",
+			features:   []Feature{WiFi, BluetoothLE, USBSerialJTAG, EmbeddedFlash, EmbeddedPSRAM},
+			bootOffset: 0,
+		},
+		{
+			name:       ChipNameESP32C3,
+			magic:      0x1b31506f,
+			registers:  withRegister(efuseWords(esp32C3EfuseBlock1, 0xa1001122, 0x00007cdf, 0, 0x08240000, 0, 0x01000000), esp32C3UartDevBufNo, esp32C3UartDevUSBJTAG),
+			mac:        "7c:df:a1:00:11:22",
+			pkg:        "ESP8685 (QFN28)",
+			revision:   "v1.1",
+			features:   []Feature{WiFi, BluetoothLE, USBSerialJTAG, EmbeddedFlash},
+			bootOffset: 0,
+			usbJTAG:    true,
+		},
+		{
+			name:       ChipNameESP32C6,
+			magic:      0x2ce0806f,
+			registers:  efuseWords(esp32C6EfuseBlock1, 0xa1001122, 0x00007cdf, 0, 0x01400000),
+			mac:        "7c:df:a1:00:11:22",
+			pkg:        "ESP32-C6FH4 (QFN32)",
+			revision:   "v1.0",
+			features:   []Feature{WiFi, BluetoothLE, IEEE802154, USBSerialJTAG, EmbeddedFlash},
+			bootOffset: 0,
+		},
+	} {
+		e, _ := newEmulatedChip(t, test.magic, test.registers)
+		if e.Chip().Name() != test.name {
+			t.Errorf("Expected magic %08X to be detected as %s, got %s", test.magic, test.name, e.Chip().Name())
+			continue
+		}
+
+		mac, err := e.GetChipMAC()
+		if err != nil || mac != test.mac {
+			t.Errorf("%s: expected MAC %s, received %s: %v", test.name, test.mac, mac, err)
+		}
+		description, err := e.GetChipDescription()
+		if err != nil {
+			t.Fatalf("%s: GetChipDescription errored with: %v", test.name, err)
+		}
+		if description.Package != test.pkg || !strings.HasSuffix(description.String(), test.revision+")") {
+			t.Errorf("%s: expected %s revision %s, received %s", test.name, test.pkg, test.revision, description.String())
+		}
+		features, err := e.GetFeatures()
+		if err != nil {
+			t.Fatalf("%s: GetFeatures errored with: %v", test.name, err)
+		}
+		for _, feature := range test.features {
+			if !features[feature] {
+				t.Errorf("%s: expected feature %s in %s", test.name, feature.String(), features.String())
+			}
+		}
+		if e.Chip().BootloaderOffset() != test.bootOffset {
+			t.Errorf("%s: expected the bootloader at %X, got %X", test.name, test.bootOffset, e.Chip().BootloaderOffset())
+		}
+		if e.USBJTAGSerial != test.usbJTAG {
+			t.Errorf("%s: expected USB-Serial/JTAG console %v", test.name, test.usbJTAG)
+		}
+	}
+}
+
+func TestWriteBootloaderChipID(t *testing.T) {
+	for _, test := range []struct {
+		magic       uint32
+		chipID      image.ChipID
+		loadAddress uint32
+		otherChipID image.ChipID
+	}{
+		{0xfff0c101, image.ChipIDESP8266, 0x40100000, image.ChipIDESP32},
+		{0x00f01d83, image.ChipIDESP32, 0x40080000, image.ChipIDESP32S2},
+		{0x1b31506f, image.ChipIDESP32C3, 0x403c0000, image.ChipIDESP32},
+	} {
+		e, _ := newEmulatedChip(t, test.magic, nil)
+		name := e.Chip().Name()
+		offset := e.Chip().BootloaderOffset()
+
+		img := &image.Image{}
+		img.Magic = image.Magic
+		img.ChipID = test.chipID
+		img.Segments = []image.Segment{{LoadAddress: test.loadAddress, Data: []byte{1, 2, 3, 4}}}
+		if err := e.WriteFlash(offset, img.Bytes(), false, false, false); err != nil {
+			t.Errorf("%s: writing its own image to the bootloader offset errored with: %v", name, err)
+		}
+		img.ChipID = test.otherChipID
+		if err := e.WriteFlash(offset, img.Bytes(), false, false, false); err == nil {
+			t.Errorf("%s: expected an image for another chip at the bootloader offset to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package esp32
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+const (
+	efuseBlockCount       = 4
+	efuseBlock0Words      = 7
+	efuseBlockWords       = 8
+	efuseBlockWordsCoding = 6 // usable words of BLK1-3 with 3/4 coding
+)
+
+var (
+	// efuseReadRegs holds the first read register of BLK0 to BLK3
+	efuseReadRegs = [efuseBlockCount]uint{efuseRegBase + 0x000, efuseRegBase + 0x038, efuseRegBase + 0x058, efuseRegBase + 0x078}
+)
+
+// EfuseCodingScheme determines how the data of BLK1 to BLK3 is stored
+type EfuseCodingScheme byte
+
+const (
+	EfuseCodingNone   EfuseCodingScheme = 0
+	EfuseCoding34     EfuseCodingScheme = 1
+	EfuseCodingRepeat EfuseCodingScheme = 2
+)
+
+func (c EfuseCodingScheme) String() string {
+	name, found := map[EfuseCodingScheme]string{
+		EfuseCodingNone:   "None",
+		EfuseCoding34:     "3/4",
+		EfuseCodingRepeat: "Repeat (UNSUPPORTED)",
+	}[c]
+	if found {
+		return name
+	}
+	return "Invalid"
+}
+
+// Efuses is a snapshot of the eFuse blocks BLK0 to BLK3 of an ESP32
+type Efuses struct {
+	// Blocks holds the words of each block as read from the read registers.
+	// With 3/4 coding the hardware decodes BLK1-3 and only the first 6 words are used.
+	Blocks [efuseBlockCount][]uint32
+}
+
+// ReadEfuses reads all eFuse blocks. Only the ESP32 eFuse layout is supported.
+func (e *ESP32ROM) ReadEfuses() (*Efuses, error) {
+	if e.chip.Name() != ChipNameESP32 {
+		return nil, fmt.Errorf("The eFuses of the %s are not supported", e.chip.Name())
+	}
+	efuses := &Efuses{}
+	for block := 0; block < efuseBlockCount; block++ {
+		words := efuseBlockWords
+		if block == 0 {
+			words = efuseBlock0Words
+		}
+		efuses.Blocks[block] = make([]uint32, words)
+		for word := 0; word < words; word++ {
+			value, err := e.readRegisterUint32(efuseReadRegs[block] + 4*uint(word))
+			if err != nil {
+				return nil, fmt.Errorf("Could not read word %d of eFuse block %d: %v", word, block, err)
+			}
+			efuses.Blocks[block][word] = value
+		}
+	}
+	return efuses, nil
+}
+
+// CodingScheme returns the coding scheme of BLK1 to BLK3
+func (f *Efuses) CodingScheme() EfuseCodingScheme {
+	return EfuseCodingScheme(f.uint(efuseField("CODING_SCHEME")))
+}
+
+// BlockLength returns the number of usable bytes of block, which depends on the coding scheme
+func (f *Efuses) BlockLength(block int) int {
+	if block == 0 {
+		return efuseBlock0Words * 4
+	}
+	if f.CodingScheme() == EfuseCoding34 {
+		return efuseBlockWordsCoding * 4
+	}
+	return efuseBlockWords * 4
+}
+
+// WriteProtected returns true if the write disable bit protecting field is burned
+func (f *Efuses) WriteProtected(field *EfuseField) bool {
+	return field.WriteDisable >= 0 && f.uint(efuseField("WR_DIS"))&(1<<uint(field.WriteDisable)) != 0
+}
+
+// ReadProtected returns true if the read disable bit protecting field is burned
+func (f *Efuses) ReadProtected(field *EfuseField) bool {
+	return field.ReadDisable >= 0 && f.uint(efuseField("RD_DIS"))&(1<<uint(field.ReadDisable)) != 0
+}
+
+func (f *Efuses) blockBytes(block int) []byte {
+	data := make([]byte, 4*len(f.Blocks[block]))
+	for index, word := range f.Blocks[block] {
+		binary.LittleEndian.PutUint32(data[4*index:], word)
+	}
+	return data[:f.BlockLength(block)]
+}
+
+// uint returns the value of a field with up to 64 bits
+func (f *Efuses) uint(field *EfuseField) uint64 {
+	value := uint64(0)
+	start := field.Word*32 + field.Shift
+	words := f.Blocks[field.Block]
+	for bit := 0; bit < field.Bits; bit++ {
+		position := start + bit
+		if position/32 < len(words) && words[position/32]&(1<<uint(position%32)) != 0 {
+			value |= 1 << uint(bit)
+		}
+	}
+	return value
+}
+
+// bytes returns the value of a byte aligned field, truncated to the usable length of its block
+func (f *Efuses) bytes(field *EfuseField) []byte {
+	data := f.blockBytes(field.Block)
+	start := (field.Word*32 + field.Shift) / 8
+	end := start + field.Bits/8
+	if end > len(data) {
+		end = len(data)
+	}
+	if start > end {
+		return []byte{}
+	}
+	return data[start:end]
+}
+
+// EfuseValue is a decoded eFuse field
+type EfuseValue struct {
+	Name           string
+	Category       string
+	Block          int
+	Value          string
+	Raw            string
+	WriteProtected bool
+	ReadProtected  bool
+	Description    string
+}
+
+// Get decodes the field with the given name
+func (f *Efuses) Get(name string) (*EfuseValue, error) {
+	field := efuseField(name)
+	if field == nil {
+		return nil, fmt.Errorf("Unknown eFuse field '%s'", name)
+	}
+	return f.decode(field), nil
+}
+
+// Values decodes all known fields
+func (f *Efuses) Values() []EfuseValue {
+	values := make([]EfuseValue, 0, len(efuseFields))
+	for index := range efuseFields {
+		values = append(values, *f.decode(&efuseFields[index]))
+	}
+	return values
+}
+
+func (f *Efuses) decode(field *EfuseField) *EfuseValue {
+	value := &EfuseValue{
+		Name:           field.Name,
+		Category:       field.Category,
+		Block:          field.Block,
+		WriteProtected: f.WriteProtected(field),
+		ReadProtected:  f.ReadProtected(field),
+		Description:    field.Description,
+	}
+
+	switch field.Type {
+	case efuseTypeBool:
+		raw := f.uint(field)
+		value.Raw = strconv.FormatUint(raw, 10)
+		value.Value = strconv.FormatBool(raw != 0)
+	case efuseTypeUint:
+		raw := f.uint(field)
+		value.Raw = fmt.Sprintf("0x%X", raw)
+		value.Value = strconv.FormatUint(raw, 10)
+		if field.format != nil {
+			value.Value = field.format(raw)
+		}
+	case efuseTypeBytes:
+		raw := f.bytes(field)
+		value.Raw = hex.EncodeToString(raw)
+		value.Value = value.Raw
+	case efuseTypeMAC, efuseTypeMACReversed:
+		raw := f.bytes(field)
+		value.Raw = hex.EncodeToString(raw)
+		mac := make(net.HardwareAddr, len(raw))
+		copy(mac, raw)
+		if field.Type == efuseTypeMACReversed {
+			for i, j := 0, len(mac)-1; i < j; i, j = i+1, j-1 {
+				mac[i], mac[j] = mac[j], mac[i]
+			}
+		}
+		crcOK := "CRC OK"
+		if byte(f.uint(efuseField(field.crcField))) != macCRC8(mac) {
+			crcOK = "CRC invalid"
+		}
+		value.Value = fmt.Sprintf("%s (%s)", mac.String(), crcOK)
+	}
+
+	if value.ReadProtected {
+		value.Value = "?? (read protected)"
+	}
+	return value
+}
+
+// macCRC8 is the CRC stored along with MAC addresses in the eFuses
+func macCRC8(mac []byte) byte {
+	crc := byte(0)
+	for _, b := range mac {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8C
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
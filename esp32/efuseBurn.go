@@ -0,0 +1,413 @@
+package esp32
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"net"
+	"strconv"
+)
+
+const (
+	efuseClkReg       uint = efuseRegBase + 0x0f8
+	efuseConfReg      uint = efuseRegBase + 0x0fc
+	efuseCmdReg       uint = efuseRegBase + 0x104
+	efuseDacConfReg   uint = efuseRegBase + 0x118
+	efuseDecStatusReg uint = efuseRegBase + 0x11c
+
+	efuseConfRead   uint32 = 0x5AA5
+	efuseConfWrite  uint32 = 0x5A5A
+	efuseCmdRead    uint32 = 0x1
+	efuseCmdProgram uint32 = 0x2
+
+	efuseDecErrorMask  uint32 = 0xFFF
+	efuseCommandPolls         = 10
+	efuseCustomMACName        = "CUSTOM_MAC"
+
+	uartClkDivReg  uint   = 0x3ff40014
+	uartClkDivMask uint32 = 0xFFFFF
+)
+
+var (
+	// efuseWriteRegs holds the first write register of BLK0 to BLK3
+	efuseWriteRegs = [efuseBlockCount]uint{efuseRegBase + 0x01c, efuseRegBase + 0x098, efuseRegBase + 0x0b8, efuseRegBase + 0x0d8}
+
+	// efuseTimings are the programming timings espefuse uses, by APB clock in MHz.
+	// The ROM loader runs the APB clock from the crystal.
+	efuseTimings = map[uint32]efuseTiming{
+		26: {clkSel0: 250, clkSel1: 255, dacClkDiv: 52},
+		40: {clkSel0: 160, clkSel1: 255, dacClkDiv: 80},
+	}
+)
+
+// efuseTiming holds the values of EFUSE_CLK_SEL0, EFUSE_CLK_SEL1 and EFUSE_DAC_CLK_DIV
+type efuseTiming struct {
+	clkSel0   uint32
+	clkSel1   uint32
+	dacClkDiv uint32
+}
+
+// EfuseChange is the pending change of a single field
+type EfuseChange struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// EfuseWordChange is the pending change of a single word of an eFuse block
+type EfuseWordChange struct {
+	Block int
+	Word  int
+	Old   uint32
+	New   uint32
+}
+
+// EfuseBurn collects the fields to burn on top of a snapshot of the eFuses.
+// Nothing is written to the chip until it is passed to BurnEfuses.
+type EfuseBurn struct {
+	efuses  *Efuses
+	result  *Efuses
+	Changes []EfuseChange
+}
+
+// NewEfuseBurn prepares burning eFuses whose current state is efuses
+func NewEfuseBurn(efuses *Efuses) *EfuseBurn {
+	return &EfuseBurn{
+		efuses: efuses,
+		result: efuses.copy(),
+	}
+}
+
+// Set schedules burning value into the field with the given name. Booleans are given as
+// true/false, numbers in Go syntax, MAC addresses colon separated and byte fields in hex.
+// Burning CUSTOM_MAC also burns its CRC and sets MAC_VERSION to 1.
+func (b *EfuseBurn) Set(name string, value string) error {
+	field := efuseField(name)
+	if field == nil {
+		return fmt.Errorf("Unknown eFuse field '%s'", name)
+	}
+	if b.efuses.WriteProtected(field) {
+		return fmt.Errorf("Field %s is write protected", name)
+	}
+	if b.efuses.ReadProtected(field) {
+		return fmt.Errorf("Field %s is read protected, its current value is unknown", name)
+	}
+	if err := b.checkCodingScheme(field); err != nil {
+		return err
+	}
+	data, err := b.parseValue(field, value)
+	if err != nil {
+		return fmt.Errorf("Invalid value for %s: %v", name, err)
+	}
+	if err = b.result.setBits(field, data); err != nil {
+		return err
+	}
+	b.setChange(field)
+
+	if field.Name == efuseCustomMACName {
+		mac, _ := net.ParseMAC(value)
+		if err = b.Set(field.crcField, strconv.Itoa(int(macCRC8(mac)))); err != nil {
+			return err
+		}
+		macVersion := efuseField("MAC_VERSION")
+		if b.result.uint(macVersion) == 0 {
+			return b.Set(macVersion.Name, "1")
+		}
+	}
+	return nil
+}
+
+// checkCodingScheme rejects writes to BLK1-3 the coding scheme does not allow
+func (b *EfuseBurn) checkCodingScheme(field *EfuseField) error {
+	if field.Block == 0 {
+		return nil
+	}
+	switch scheme := b.efuses.CodingScheme(); scheme {
+	case EfuseCodingNone:
+		return nil
+	case EfuseCoding34:
+		// the check bytes are calculated over the whole block, so it can only be burned once
+		for _, word := range b.efuses.Blocks[field.Block] {
+			if word != 0 {
+				return fmt.Errorf("BLK%d already contains data and can only be burned once with 3/4 coding", field.Block)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("Burning BLK%d with coding scheme %s is not supported", field.Block, scheme)
+	}
+}
+
+// parseValue returns value as little endian bytes
+func (b *EfuseBurn) parseValue(field *EfuseField, value string) ([]byte, error) {
+	switch field.Type {
+	case efuseTypeBool:
+		set, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if set {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case efuseTypeUint:
+		number, err := strconv.ParseUint(value, 0, field.Bits)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, number)
+		return data, nil
+	case efuseTypeBytes:
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		if length := len(b.efuses.bytes(field)); len(data) != length {
+			return nil, fmt.Errorf("expected %d bytes, got %d", length, len(data))
+		}
+		return data, nil
+	case efuseTypeMAC, efuseTypeMACReversed:
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(mac) != field.Bits/8 {
+			return nil, fmt.Errorf("expected a %d byte MAC address", field.Bits/8)
+		}
+		if field.Type == efuseTypeMACReversed {
+			for i, j := 0, len(mac)-1; i < j; i, j = i+1, j-1 {
+				mac[i], mac[j] = mac[j], mac[i]
+			}
+		}
+		return mac, nil
+	}
+	return nil, fmt.Errorf("unsupported field type")
+}
+
+func (b *EfuseBurn) setChange(field *EfuseField) {
+	change := EfuseChange{
+		Name: field.Name,
+		Old:  b.efuses.decode(field).Value,
+		New:  b.result.decode(field).Value,
+	}
+	for index := range b.Changes {
+		if b.Changes[index].Name == field.Name {
+			b.Changes[index] = change
+			return
+		}
+	}
+	b.Changes = append(b.Changes, change)
+}
+
+// WordChanges lists every eFuse word that gets bits burned
+func (b *EfuseBurn) WordChanges() []EfuseWordChange {
+	changes := []EfuseWordChange{}
+	for block := range b.result.Blocks {
+		for word, value := range b.result.Blocks[block] {
+			if old := b.efuses.Blocks[block][word]; old != value {
+				changes = append(changes, EfuseWordChange{Block: block, Word: word, Old: old, New: value})
+			}
+		}
+	}
+	return changes
+}
+
+// Empty returns true if no bits are to be burned
+func (b *EfuseBurn) Empty() bool {
+	return len(b.WordChanges()) == 0
+}
+
+// blockData returns the words to put into the write registers of block, nil if nothing is to be burned
+func (b *EfuseBurn) blockData(block int) []uint32 {
+	pending := make([]uint32, len(b.result.Blocks[block]))
+	empty := true
+	for word, value := range b.result.Blocks[block] {
+		pending[word] = value &^ b.efuses.Blocks[block][word]
+		empty = empty && pending[word] == 0
+	}
+	if empty {
+		return nil
+	}
+	if block > 0 && b.efuses.CodingScheme() == EfuseCoding34 {
+		return encodeEfuse34(b.result.blockBytes(block))
+	}
+	return pending
+}
+
+// BurnEfuses programs the changes collected in burn and verifies them by reading the eFuses back.
+// This can't be undone.
+func (e *ESP32ROM) BurnEfuses(burn *EfuseBurn) error {
+	current, err := e.ReadEfuses()
+	if err != nil {
+		return err
+	}
+	for block := range current.Blocks {
+		for word, value := range current.Blocks[block] {
+			if value != burn.efuses.Blocks[block][word] {
+				return fmt.Errorf("The eFuses changed since the burn was prepared")
+			}
+		}
+	}
+
+	crystalFrequency, err := e.GetCrystalFrequency()
+	if err != nil {
+		return err
+	}
+	timing := efuseTimings[crystalFrequency]
+	e.logger.Printf("Using the eFuse timing for a %dMHz crystal", crystalFrequency)
+	if err = e.WriteRegister(efuseDacConfReg, timing.dacClkDiv, 0xFF, 0); err != nil {
+		return err
+	}
+	if err = e.WriteRegister(efuseClkReg, timing.clkSel1<<8|timing.clkSel0, 0xFFFF, 0); err != nil {
+		return err
+	}
+
+	written := []int{}
+	for block := range burn.result.Blocks {
+		data := burn.blockData(block)
+		if data == nil {
+			continue
+		}
+		e.logger.Printf("Writing BLK%d", block)
+		for word, value := range data {
+			if err = e.WriteRegister(efuseWriteRegs[block]+4*uint(word), value, 0xFFFFFFFF, 0); err != nil {
+				return err
+			}
+		}
+		written = append(written, block)
+	}
+	if len(written) == 0 {
+		return nil
+	}
+	if err = e.efuseCommand(efuseConfWrite, efuseCmdProgram); err != nil {
+		return err
+	}
+	for _, block := range written {
+		for word := range burn.result.Blocks[block] {
+			if err = e.WriteRegister(efuseWriteRegs[block]+4*uint(word), 0, 0xFFFFFFFF, 0); err != nil {
+				return err
+			}
+		}
+	}
+	if err = e.efuseCommand(efuseConfRead, efuseCmdRead); err != nil {
+		return err
+	}
+
+	if burn.efuses.CodingScheme() == EfuseCoding34 {
+		status, err := e.readRegisterUint32(efuseDecStatusReg)
+		if err != nil {
+			return err
+		}
+		if status&efuseDecErrorMask != 0 {
+			return fmt.Errorf("3/4 coding errors after burning, EFUSE_DEC_STATUS is %03X", status&efuseDecErrorMask)
+		}
+	}
+	burned, err := e.ReadEfuses()
+	if err != nil {
+		return err
+	}
+	for _, block := range written {
+		for word, expected := range burn.result.Blocks[block] {
+			if value := burned.Blocks[block][word]; value&expected != expected {
+				return fmt.Errorf("Burning BLK%d failed, word %d reads %08X instead of %08X", block, word, value, expected)
+			}
+		}
+	}
+	return nil
+}
+
+// efuseCommand runs an eFuse controller command and waits for it to finish
+func (e *ESP32ROM) efuseCommand(conf uint32, command uint32) error {
+	if err := e.WriteRegister(efuseConfReg, conf, 0xFFFFFFFF, 0); err != nil {
+		return err
+	}
+	if err := e.WriteRegister(efuseCmdReg, command, 0xFFFFFFFF, 0); err != nil {
+		return err
+	}
+	for poll := 0; poll < efuseCommandPolls; poll++ {
+		value, err := e.readRegisterUint32(efuseCmdReg)
+		if err != nil {
+			return err
+		}
+		if value == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("The eFuse controller did not finish command %X", command)
+}
+
+func (f *Efuses) copy() *Efuses {
+	efuses := &Efuses{}
+	for block, words := range f.Blocks {
+		efuses.Blocks[block] = append([]uint32{}, words...)
+	}
+	return efuses
+}
+
+// setBits burns the bits of data into field. Bits already burned can't be cleared.
+func (f *Efuses) setBits(field *EfuseField, data []byte) error {
+	start := field.Word*32 + field.Shift
+	words := f.Blocks[field.Block]
+	length := field.Bits
+	if 8*len(data) < length {
+		length = 8 * len(data)
+	}
+	for bit := 0; bit < length; bit++ {
+		position := start + bit
+		if words[position/32]&(1<<uint(position%32)) != 0 && data[bit/8]&(1<<uint(bit%8)) == 0 {
+			return fmt.Errorf("Field %s already has bit %d burned, eFuse bits can't be cleared", field.Name, bit)
+		}
+	}
+	for bit := 0; bit < length; bit++ {
+		position := start + bit
+		if data[bit/8]&(1<<uint(bit%8)) != 0 {
+			words[position/32] |= 1 << uint(position%32)
+		}
+	}
+	return nil
+}
+
+// encodeEfuse34 adds the check bytes of the 3/4 coding scheme to 24 bytes of block data:
+// every 6 bytes are followed by their xor and the sum of their bit counts weighted by position
+func encodeEfuse34(data []byte) []uint32 {
+	raw := make([]byte, 0, efuseBlockWords*4)
+	for offset := 0; offset < len(data); offset += 6 {
+		chunk := data[offset : offset+6]
+		xor, weight := byte(0), 0
+		for index, b := range chunk {
+			xor ^= b
+			weight += (index + 1) * bits.OnesCount8(b)
+		}
+		raw = append(raw, chunk...)
+		raw = append(raw, xor, byte(weight))
+	}
+	words := make([]uint32, efuseBlockWords)
+	for index := range words {
+		words[index] = binary.LittleEndian.Uint32(raw[4*index:])
+	}
+	return words
+}
+
+// GetCrystalFrequency estimates the crystal frequency of an ESP32 in MHz from the UART clock
+// divider and the current baudrate, like esptool.py does. It fails unless it is close to 26 or 40MHz.
+func (e *ESP32ROM) GetCrystalFrequency() (uint32, error) {
+	if e.chip.Name() != ChipNameESP32 {
+		return 0, fmt.Errorf("Detecting the crystal frequency of the %s is not supported", e.chip.Name())
+	}
+	clkDiv, err := e.readRegisterUint32(uartClkDivReg)
+	if err != nil {
+		return 0, err
+	}
+	estimated := float64(e.baudrate) * float64(clkDiv&uartClkDivMask) / 1e6
+	frequency := uint32(26)
+	if estimated > 33 {
+		frequency = 40
+	}
+	if math.Abs(float64(frequency)-estimated) > 1 {
+		return 0, fmt.Errorf("Unsupported crystal frequency, estimated %.1fMHz from UART divider %d at %d baud", estimated, clkDiv&uartClkDivMask, e.baudrate)
+	}
+	return frequency, nil
+}
@@ -0,0 +1,171 @@
+package esp32
+
+import (
+	"github.com/fluepke/esptool/emulator"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func prepareBurn(t *testing.T, e *ESP32ROM, values map[string]string) *EfuseBurn {
+	efuses, err := e.ReadEfuses()
+	if err != nil {
+		t.Fatalf("ReadEfuses errored with: %v", err)
+	}
+	burn := NewEfuseBurn(efuses)
+	for name, value := range values {
+		if err = burn.Set(name, value); err != nil {
+			t.Fatalf("Set(%s) errored with: %v", name, err)
+		}
+	}
+	return burn
+}
+
+func TestBurnEfuses(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	dir, err := ioutil.TempDir("", "efuse_test")
+	if err != nil {
+		t.Fatalf("TempDir errored with: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	efuseFile := filepath.Join(dir, "efuse.json")
+	device.EfuseFile = efuseFile
+
+	burn := prepareBurn(t, e, map[string]string{
+		"CUSTOM_MAC":     "02:aa:bb:cc:dd:ee",
+		"XPD_SDIO_FORCE": "true",
+		"XPD_SDIO_REG":   "true",
+		"XPD_SDIO_TIEH":  "1",
+		"JTAG_DISABLE":   "true",
+		"BLOCK1":         testKey,
+	})
+	if len(burn.Changes) != 8 {
+		t.Errorf("Expected 8 changed fields including CRC and MAC version, got %d", len(burn.Changes))
+	}
+	if changes := burn.WordChanges(); len(changes) != 13 || changes[0].Block != 0 || changes[0].Word != 4 {
+		t.Errorf("Unexpected word changes %v", changes)
+	}
+
+	if err := e.BurnEfuses(burn); err != nil {
+		t.Fatalf("BurnEfuses errored with: %v", err)
+	}
+	efuses, err := e.ReadEfuses()
+	if err != nil {
+		t.Fatalf("ReadEfuses errored with: %v", err)
+	}
+	assertEfuseValue(t, efuses, "CUSTOM_MAC", "02:aa:bb:cc:dd:ee (CRC OK)")
+	assertEfuseValue(t, efuses, "MAC_VERSION", "1")
+	assertEfuseValue(t, efuses, "XPD_SDIO_TIEH", "3.3V")
+	assertEfuseValue(t, efuses, "JTAG_DISABLE", "true")
+	assertEfuseValue(t, efuses, "BLOCK1", testKey)
+	assertEfuseValue(t, efuses, "MAC", "24:6f:28:92:ef:20 (CRC OK)")
+
+	restored := emulator.NewDevice(4*1024*1024, nil)
+	if err = restored.LoadEfuses(efuseFile); err != nil {
+		t.Fatalf("LoadEfuses errored with: %v", err)
+	}
+	restoredRom := NewESP32ROM(restored, log.New(ioutil.Discard, "", 0))
+	if err = restoredRom.Connect(3); err != nil {
+		t.Fatalf("Connect errored with: %v", err)
+	}
+	restoredEfuses, err := restoredRom.ReadEfuses()
+	if err != nil {
+		t.Fatalf("ReadEfuses errored with: %v", err)
+	}
+	assertEfuseValue(t, restoredEfuses, "CUSTOM_MAC", "02:aa:bb:cc:dd:ee (CRC OK)")
+}
+
+func TestBurnEfusesCoding34(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	device.SetEfuse(6, uint32(EfuseCoding34))
+
+	key := testKey[:48]
+	burn := prepareBurn(t, e, map[string]string{"BLOCK2": key})
+	if err := e.BurnEfuses(burn); err != nil {
+		t.Fatalf("BurnEfuses errored with: %v", err)
+	}
+	efuses, err := e.ReadEfuses()
+	if err != nil {
+		t.Fatalf("ReadEfuses errored with: %v", err)
+	}
+	assertEfuseValue(t, efuses, "BLOCK2", key)
+
+	efuses.Blocks[2][0] = 0
+	if err = NewEfuseBurn(efuses).Set("BLOCK3", key); err != nil {
+		t.Errorf("Expected an empty block to be writable with 3/4 coding, got: %v", err)
+	}
+	if err = NewEfuseBurn(efuses).Set("BLOCK2", key); err == nil || !strings.Contains(err.Error(), "only be burned once") {
+		t.Errorf("Expected an error burning a used block with 3/4 coding, got: %v", err)
+	}
+	if err = NewEfuseBurn(efuses).Set("BLOCK3", testKey); err == nil {
+		t.Errorf("Expected 32 byte keys to be rejected with 3/4 coding")
+	}
+}
+
+func TestBurnEfusesCrystalFrequency(t *testing.T) {
+	for _, xtal := range []uint32{26, 40} {
+		e, device := newEmulatedESP32ROM(t)
+		device.XtalFrequency = xtal
+		if frequency, err := e.GetCrystalFrequency(); err != nil || frequency != xtal {
+			t.Errorf("Expected a %dMHz crystal, got %d: %v", xtal, frequency, err)
+		}
+		burn := prepareBurn(t, e, map[string]string{"JTAG_DISABLE": "true"})
+		if err := e.BurnEfuses(burn); err != nil {
+			t.Errorf("BurnEfuses with a %dMHz crystal errored with: %v", xtal, err)
+		}
+	}
+
+	e, device := newEmulatedESP32ROM(t)
+	device.XtalFrequency = 32
+	burn := prepareBurn(t, e, map[string]string{"JTAG_DISABLE": "true"})
+	if err := e.BurnEfuses(burn); err == nil || !strings.Contains(err.Error(), "crystal frequency") {
+		t.Errorf("Expected burning with an unknown crystal frequency to fail, got: %v", err)
+	}
+	efuses, err := e.ReadEfuses()
+	if err != nil {
+		t.Fatalf("ReadEfuses errored with: %v", err)
+	}
+	assertEfuseValue(t, efuses, "JTAG_DISABLE", "false")
+}
+
+func TestEfuseBurnSafeguards(t *testing.T) {
+	efuses := &Efuses{}
+	efuses.Blocks[0] = make([]uint32, efuseBlock0Words)
+	for block := 1; block < efuseBlockCount; block++ {
+		efuses.Blocks[block] = make([]uint32, efuseBlockWords)
+	}
+	efuses.Blocks[0][0] = 0x00020080 // write protect BLK1, read protect BLK2
+	efuses.Blocks[0][6] = 0x00000040 // JTAG_DISABLE
+
+	for _, test := range []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"BLOCK1", testKey, "write protected"},
+		{"BLOCK2", testKey, "read protected"},
+		{"JTAG_DISABLE", "false", "can't be cleared"},
+		{"CUSTOM_MAC", "12:34:56", "Invalid value"},
+		{"FLASH_CRYPT_CNT", "0x80", "Invalid value"},
+		{"UNKNOWN", "1", "Unknown eFuse field"},
+	} {
+		burn := NewEfuseBurn(efuses)
+		err := burn.Set(test.name, test.value)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected Set(%s, %s) to fail with '%s', got: %v", test.name, test.value, test.err, err)
+		}
+		if !burn.Empty() {
+			t.Errorf("Expected a failed Set(%s) to leave no pending changes", test.name)
+		}
+	}
+
+	burn := NewEfuseBurn(efuses)
+	if err := burn.Set("JTAG_DISABLE", "true"); err != nil || !burn.Empty() {
+		t.Errorf("Expected burning an already burned bit to be a no-op, got: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package esp32
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+type efuseFieldType int
+
+const (
+	efuseTypeBool efuseFieldType = iota
+	efuseTypeUint
+	efuseTypeBytes
+	efuseTypeMAC
+	// efuseTypeMACReversed is a MAC address stored with its last byte first
+	efuseTypeMACReversed
+)
+
+const (
+	vrefOffset     = 1100 // mV
+	vrefStep       = 7    // mV
+	adcTPStep      = 4
+	adc1TPLowBase  = 278
+	adc1TPHighBase = 3265
+	adc2TPLowBase  = 421
+	adc2TPHighBase = 3406
+)
+
+// EfuseField describes where a named value is stored in the eFuse blocks
+type EfuseField struct {
+	Name     string
+	Category string
+	Block    int
+	Word     int
+	Shift    int
+	Bits     int
+	Type     efuseFieldType
+	// WriteDisable is the bit of WR_DIS protecting the field from being burned, -1 if none
+	WriteDisable int
+	// ReadDisable is the bit of RD_DIS protecting the field from being read, -1 if none
+	ReadDisable int
+	Description string
+	format      func(value uint64) string
+	crcField    string
+}
+
+var efuseFields = []EfuseField{
+	{Name: "WR_DIS", Category: "efuse", Block: 0, Word: 0, Shift: 0, Bits: 16, Type: efuseTypeUint, WriteDisable: 1, ReadDisable: -1, Description: "Efuse write disable mask"},
+	{Name: "RD_DIS", Category: "efuse", Block: 0, Word: 0, Shift: 16, Bits: 4, Type: efuseTypeUint, WriteDisable: 0, ReadDisable: -1, Description: "Efuse read disable mask"},
+	{Name: "CODING_SCHEME", Category: "efuse", Block: 0, Word: 6, Shift: 0, Bits: 2, Type: efuseTypeUint, WriteDisable: 10, ReadDisable: 3, Description: "Efuse variable block length scheme", format: formatCodingScheme},
+	{Name: "KEY_STATUS", Category: "efuse", Block: 0, Word: 6, Shift: 10, Bits: 1, Type: efuseTypeBool, WriteDisable: 10, ReadDisable: 3, Description: "Usage of efuse block 3 (reserved)"},
+
+	{Name: "MAC", Category: "identity", Block: 0, Word: 1, Shift: 0, Bits: 48, Type: efuseTypeMACReversed, WriteDisable: 3, ReadDisable: -1, Description: "Factory MAC address", crcField: "MAC_CRC"},
+	{Name: "MAC_CRC", Category: "identity", Block: 0, Word: 2, Shift: 16, Bits: 8, Type: efuseTypeUint, WriteDisable: 3, ReadDisable: -1, Description: "CRC8 for factory MAC address"},
+	{Name: "CHIP_VER_DIS_APP_CPU", Category: "identity", Block: 0, Word: 3, Shift: 0, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "Disables APP CPU"},
+	{Name: "CHIP_VER_DIS_BT", Category: "identity", Block: 0, Word: 3, Shift: 1, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "Disables Bluetooth"},
+	{Name: "CHIP_VER_PKG_4BIT", Category: "identity", Block: 0, Word: 3, Shift: 2, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "Chip package identifier #4bit"},
+	{Name: "CHIP_VER_DIS_CACHE", Category: "identity", Block: 0, Word: 3, Shift: 3, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "Disables cache"},
+	{Name: "CHIP_PACKAGE", Category: "identity", Block: 0, Word: 3, Shift: 9, Bits: 3, Type: efuseTypeUint, WriteDisable: 3, ReadDisable: -1, Description: "Chip package identifier", format: formatChipPackage},
+	{Name: "CHIP_CPU_FREQ_LOW", Category: "identity", Block: 0, Word: 3, Shift: 12, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "If set alongside CHIP_CPU_FREQ_RATED, the ESP32 max CPU frequency is 160MHz"},
+	{Name: "CHIP_CPU_FREQ_RATED", Category: "identity", Block: 0, Word: 3, Shift: 13, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "If set, the ESP32 max CPU frequency has been rated"},
+	{Name: "CHIP_VER_REV1", Category: "identity", Block: 0, Word: 3, Shift: 15, Bits: 1, Type: efuseTypeBool, WriteDisable: 3, ReadDisable: -1, Description: "Bit is set to 1 for rev1 silicon"},
+	{Name: "CHIP_VER_REV2", Category: "identity", Block: 0, Word: 5, Shift: 20, Bits: 1, Type: efuseTypeBool, WriteDisable: 6, ReadDisable: -1, Description: "Bit is set to 1 for rev2 silicon"},
+	{Name: "WAFER_VERSION_MINOR", Category: "identity", Block: 0, Word: 5, Shift: 24, Bits: 2, Type: efuseTypeUint, WriteDisable: 6, ReadDisable: -1, Description: "Minor wafer version"},
+	{Name: "CUSTOM_MAC", Category: "identity", Block: 3, Word: 0, Shift: 8, Bits: 48, Type: efuseTypeMAC, WriteDisable: 9, ReadDisable: 2, Description: "Custom MAC address", crcField: "CUSTOM_MAC_CRC"},
+	{Name: "CUSTOM_MAC_CRC", Category: "identity", Block: 3, Word: 0, Shift: 0, Bits: 8, Type: efuseTypeUint, WriteDisable: 9, ReadDisable: 2, Description: "CRC8 for custom MAC address"},
+	{Name: "MAC_VERSION", Category: "identity", Block: 3, Word: 5, Shift: 24, Bits: 8, Type: efuseTypeUint, WriteDisable: 9, ReadDisable: 2, Description: "Version of the MAC field in BLK3, 1 for a custom MAC"},
+
+	{Name: "SPI_PAD_CONFIG_HD", Category: "config", Block: 0, Word: 3, Shift: 4, Bits: 5, Type: efuseTypeUint, WriteDisable: 3, ReadDisable: -1, Description: "Override SD_DATA_2 pad (GPIO9/SPIHD)", format: formatSpiPad},
+	{Name: "SPI_PAD_CONFIG_CLK", Category: "config", Block: 0, Word: 5, Shift: 0, Bits: 5, Type: efuseTypeUint, WriteDisable: 6, ReadDisable: -1, Description: "Override SD_CLK pad (GPIO6/SPICLK)", format: formatSpiPad},
+	{Name: "SPI_PAD_CONFIG_Q", Category: "config", Block: 0, Word: 5, Shift: 5, Bits: 5, Type: efuseTypeUint, WriteDisable: 6, ReadDisable: -1, Description: "Override SD_DATA_0 pad (GPIO7/SPIQ)", format: formatSpiPad},
+	{Name: "SPI_PAD_CONFIG_D", Category: "config", Block: 0, Word: 5, Shift: 10, Bits: 5, Type: efuseTypeUint, WriteDisable: 6, ReadDisable: -1, Description: "Override SD_DATA_1 pad (GPIO8/SPID)", format: formatSpiPad},
+	{Name: "SPI_PAD_CONFIG_CS0", Category: "config", Block: 0, Word: 5, Shift: 15, Bits: 5, Type: efuseTypeUint, WriteDisable: 6, ReadDisable: -1, Description: "Override SD_CMD pad (GPIO11/SPICS0)", format: formatSpiPad},
+	{Name: "CLK8M_FREQ", Category: "config", Block: 0, Word: 4, Shift: 0, Bits: 8, Type: efuseTypeUint, WriteDisable: 4, ReadDisable: -1, Description: "8MHz clock frequency override"},
+	{Name: "XPD_SDIO_REG", Category: "config", Block: 0, Word: 4, Shift: 14, Bits: 1, Type: efuseTypeBool, WriteDisable: 5, ReadDisable: -1, Description: "VDD_SDIO regulator is powered on at reset"},
+	{Name: "XPD_SDIO_TIEH", Category: "config", Block: 0, Word: 4, Shift: 15, Bits: 1, Type: efuseTypeUint, WriteDisable: 5, ReadDisable: -1, Description: "VDD_SDIO voltage if XPD_SDIO_FORCE is set", format: formatSdioVoltage},
+	{Name: "XPD_SDIO_FORCE", Category: "config", Block: 0, Word: 4, Shift: 16, Bits: 1, Type: efuseTypeBool, WriteDisable: 5, ReadDisable: -1, Description: "Ignore MTDI pin (GPIO12) for VDD_SDIO on reset"},
+	{Name: "DISABLE_SDIO_HOST", Category: "config", Block: 0, Word: 6, Shift: 3, Bits: 1, Type: efuseTypeBool, WriteDisable: -1, ReadDisable: -1, Description: "Disables the SDIO host"},
+
+	{Name: "ADC_VREF", Category: "calibration", Block: 0, Word: 4, Shift: 8, Bits: 5, Type: efuseTypeUint, WriteDisable: 4, ReadDisable: -1, Description: "True ADC reference voltage", format: formatVref},
+	{Name: "BLK3_PART_RESERVE", Category: "calibration", Block: 0, Word: 3, Shift: 14, Bits: 1, Type: efuseTypeBool, WriteDisable: 10, ReadDisable: 3, Description: "BLK3 is partially reserved for ADC calibration data"},
+	{Name: "ADC1_TP_LOW", Category: "calibration", Block: 3, Word: 3, Shift: 0, Bits: 7, Type: efuseTypeUint, WriteDisable: 9, ReadDisable: 2, Description: "ADC1 150mV reading", format: formatTwoPoint(7, adc1TPLowBase)},
+	{Name: "ADC1_TP_HIGH", Category: "calibration", Block: 3, Word: 3, Shift: 7, Bits: 9, Type: efuseTypeUint, WriteDisable: 9, ReadDisable: 2, Description: "ADC1 850mV reading", format: formatTwoPoint(9, adc1TPHighBase)},
+	{Name: "ADC2_TP_LOW", Category: "calibration", Block: 3, Word: 3, Shift: 16, Bits: 7, Type: efuseTypeUint, WriteDisable: 9, ReadDisable: 2, Description: "ADC2 150mV reading", format: formatTwoPoint(7, adc2TPLowBase)},
+	{Name: "ADC2_TP_HIGH", Category: "calibration", Block: 3, Word: 3, Shift: 23, Bits: 9, Type: efuseTypeUint, WriteDisable: 9, ReadDisable: 2, Description: "ADC2 850mV reading", format: formatTwoPoint(9, adc2TPHighBase)},
+
+	{Name: "FLASH_CRYPT_CNT", Category: "security", Block: 0, Word: 0, Shift: 20, Bits: 7, Type: efuseTypeUint, WriteDisable: 2, ReadDisable: -1, Description: "Flash encryption is enabled if this field has an odd number of bits set", format: formatFlashCryptCount},
+	{Name: "UART_DOWNLOAD_DIS", Category: "security", Block: 0, Word: 0, Shift: 27, Bits: 1, Type: efuseTypeBool, WriteDisable: 2, ReadDisable: -1, Description: "Disable UART download mode (ESP32 rev3 only)"},
+	{Name: "FLASH_CRYPT_CONFIG", Category: "security", Block: 0, Word: 5, Shift: 28, Bits: 4, Type: efuseTypeUint, WriteDisable: 10, ReadDisable: 3, Description: "Flash encryption config (key tweak bits)"},
+	{Name: "CONSOLE_DEBUG_DISABLE", Category: "security", Block: 0, Word: 6, Shift: 2, Bits: 1, Type: efuseTypeBool, WriteDisable: 15, ReadDisable: -1, Description: "Disable ROM BASIC interpreter fallback"},
+	{Name: "ABS_DONE_0", Category: "security", Block: 0, Word: 6, Shift: 4, Bits: 1, Type: efuseTypeBool, WriteDisable: 12, ReadDisable: -1, Description: "Secure boot V1 is enabled for bootloader image"},
+	{Name: "ABS_DONE_1", Category: "security", Block: 0, Word: 6, Shift: 5, Bits: 1, Type: efuseTypeBool, WriteDisable: 13, ReadDisable: -1, Description: "Secure boot V2 is enabled for bootloader image"},
+	{Name: "JTAG_DISABLE", Category: "security", Block: 0, Word: 6, Shift: 6, Bits: 1, Type: efuseTypeBool, WriteDisable: 14, ReadDisable: -1, Description: "Disable JTAG"},
+	{Name: "DISABLE_DL_ENCRYPT", Category: "security", Block: 0, Word: 6, Shift: 7, Bits: 1, Type: efuseTypeBool, WriteDisable: 15, ReadDisable: -1, Description: "Disable flash encryption in UART bootloader"},
+	{Name: "DISABLE_DL_DECRYPT", Category: "security", Block: 0, Word: 6, Shift: 8, Bits: 1, Type: efuseTypeBool, WriteDisable: 15, ReadDisable: -1, Description: "Disable flash decryption in UART bootloader"},
+	{Name: "DISABLE_DL_CACHE", Category: "security", Block: 0, Word: 6, Shift: 9, Bits: 1, Type: efuseTypeBool, WriteDisable: 15, ReadDisable: -1, Description: "Disable flash cache in UART bootloader"},
+	{Name: "BLOCK1", Category: "security", Block: 1, Word: 0, Shift: 0, Bits: 256, Type: efuseTypeBytes, WriteDisable: 7, ReadDisable: 0, Description: "Flash encryption key"},
+	{Name: "BLOCK2", Category: "security", Block: 2, Word: 0, Shift: 0, Bits: 256, Type: efuseTypeBytes, WriteDisable: 8, ReadDisable: 1, Description: "Secure boot key"},
+	{Name: "BLOCK3", Category: "security", Block: 3, Word: 0, Shift: 0, Bits: 256, Type: efuseTypeBytes, WriteDisable: 9, ReadDisable: 2, Description: "Variable block 3"},
+}
+
+// efuseField looks up a field by name, returns nil if there is none
+func efuseField(name string) *EfuseField {
+	for index := range efuseFields {
+		if efuseFields[index].Name == name {
+			return &efuseFields[index]
+		}
+	}
+	return nil
+}
+
+func formatCodingScheme(value uint64) string {
+	return EfuseCodingScheme(value).String()
+}
+
+func formatChipPackage(value uint64) string {
+	return ChipType(value).String()
+}
+
+func formatSpiPad(value uint64) string {
+	if value == 0 {
+		return "0 (default)"
+	}
+	return fmt.Sprintf("GPIO%d", value)
+}
+
+func formatSdioVoltage(value uint64) string {
+	if value != 0 {
+		return "3.3V"
+	}
+	return "1.8V"
+}
+
+func formatFlashCryptCount(value uint64) string {
+	if bits.OnesCount64(value)%2 == 1 {
+		return fmt.Sprintf("%d (enabled)", value)
+	}
+	return fmt.Sprintf("%d (disabled)", value)
+}
+
+// formatVref decodes the sign-magnitude deviation of the ADC reference voltage
+func formatVref(value uint64) string {
+	deviation := int(value&0x0F) * vrefStep
+	if value&0x10 != 0 {
+		deviation = -deviation
+	}
+	return fmt.Sprintf("%dmV", vrefOffset+deviation)
+}
+
+// formatTwoPoint decodes a two's complement deviation from base in steps of adcTPStep
+func formatTwoPoint(bitLength uint, base int) func(value uint64) string {
+	return func(value uint64) string {
+		deviation := int(value)
+		if value&(1<<(bitLength-1)) != 0 {
+			deviation -= 1 << bitLength
+		}
+		return strconv.Itoa(base + deviation*adcTPStep)
+	}
+}
@@ -0,0 +1,66 @@
+package esp32
+
+import (
+	"testing"
+)
+
+func assertEfuseValue(t *testing.T, efuses *Efuses, name string, expected string) {
+	value, err := efuses.Get(name)
+	if err != nil {
+		t.Fatalf("Get(%s) errored with: %v", name, err)
+	}
+	if value.Value != expected {
+		t.Errorf("Expected %s to be '%s', got '%s'", name, expected, value.Value)
+	}
+}
+
+func TestReadEfuses(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	device.SetEfuse(0, 0x00100080)        // FLASH_CRYPT_CNT = 1, write protect BLK1
+	device.SetEfuse(4, 0x0000D300)        // ADC_VREF = -3 steps, VDD_SDIO forced to 3.3V
+	device.SetEfuse(6, 0x00000050)        // JTAG_DISABLE, ABS_DONE_0
+	device.SetEfuseWord(3, 0, 0x56341288) // BLK3: custom MAC 12:34:56:78:9a:bc with CRC 88
+	device.SetEfuseWord(3, 1, 0x00BC9A78)
+
+	efuses, err := e.ReadEfuses()
+	if err != nil {
+		t.Fatalf("ReadEfuses errored with: %v", err)
+	}
+
+	assertEfuseValue(t, efuses, "MAC", "24:6f:28:92:ef:20 (CRC OK)")
+	assertEfuseValue(t, efuses, "CHIP_PACKAGE", "ESP32D0WDQ6")
+	assertEfuseValue(t, efuses, "CHIP_VER_REV1", "true")
+	assertEfuseValue(t, efuses, "FLASH_CRYPT_CNT", "1 (enabled)")
+	assertEfuseValue(t, efuses, "ADC_VREF", "1079mV")
+	assertEfuseValue(t, efuses, "XPD_SDIO_TIEH", "3.3V")
+	assertEfuseValue(t, efuses, "JTAG_DISABLE", "true")
+	assertEfuseValue(t, efuses, "ABS_DONE_0", "true")
+	assertEfuseValue(t, efuses, "ABS_DONE_1", "false")
+	assertEfuseValue(t, efuses, "CODING_SCHEME", "None")
+	assertEfuseValue(t, efuses, "CUSTOM_MAC", "12:34:56:78:9a:bc (CRC invalid)")
+
+	blk1, _ := efuses.Get("BLOCK1")
+	if !blk1.WriteProtected || blk1.ReadProtected {
+		t.Errorf("Expected BLOCK1 to be write protected only")
+	}
+	if len(efuses.Values()) != len(efuseFields) {
+		t.Errorf("Expected a value for every field")
+	}
+}
+
+func TestEfusesCoding34(t *testing.T) {
+	efuses := &Efuses{}
+	efuses.Blocks[0] = make([]uint32, efuseBlock0Words)
+	for block := 1; block < efuseBlockCount; block++ {
+		efuses.Blocks[block] = []uint32{1, 2, 3, 4, 5, 6, 7, 8}
+	}
+	efuses.Blocks[0][0] = 0x00020000 // RD_DIS bit 1, BLK2
+	efuses.Blocks[0][6] = uint32(EfuseCoding34)
+
+	if efuses.CodingScheme() != EfuseCoding34 || efuses.BlockLength(3) != 24 {
+		t.Fatalf("Expected 24 byte blocks with 3/4 coding")
+	}
+	assertEfuseValue(t, efuses, "BLOCK1", "010000000200000003000000040000000500000006000000")
+	assertEfuseValue(t, efuses, "BLOCK2", "?? (read protected)")
+	assertEfuseValue(t, efuses, "MAC_VERSION", "0")
+}
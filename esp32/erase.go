@@ -0,0 +1,117 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/common"
+	"github.com/fluepke/esptool/image"
+	"time"
+)
+
+const (
+	flashSectorSize          uint32 = 0x1000
+	eraseTimeoutPerMB               = 30 * time.Second
+	eraseFlashTimeout               = 120 * time.Second
+	eraseMinimumTimeout             = 3 * time.Second
+	flashBeginMinimumTimeout        = 10 * time.Second
+)
+
+// eraseTimeout scales the time to wait for an erase operation with its size
+func eraseTimeout(size uint32, minimum time.Duration) time.Duration {
+	timeout := time.Duration(float64(eraseTimeoutPerMB) * float64(size) / (1024 * 1024))
+	if timeout < minimum {
+		return minimum
+	}
+	return timeout
+}
+
+// EraseFlash erases the entire flash chip. Without the stub the flash size is taken from the JEDEC ID,
+// or if that can't be decoded from the bootloader image header.
+func (e *ESP32ROM) EraseFlash() (err error) {
+	if !e.flashAttached {
+		err = e.AttachSpiFlash()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !e.stubLoaded {
+		size, err := e.DetectFlashSize()
+		if err != nil {
+			e.logger.Printf("Using the flash size of the bootloader header: %v", err)
+			var headerSize uint32
+			headerSize, err = e.headerFlashSize()
+			size = int(headerSize)
+		}
+		if err != nil {
+			return fmt.Errorf("Erasing the whole flash without stub requires the flash size: %v", err)
+		}
+		return e.eraseRegionROM(0, uint32(size))
+	}
+
+	e.logger.Print("Erasing flash, this may take a while")
+	_, err = e.CheckExecuteCommand(
+		common.NewEraseFlashCommand(),
+		eraseFlashTimeout,
+		1,
+	)
+	return err
+}
+
+// EraseRegion erases size bytes starting at offset. Both have to be aligned to the 4KB sector size.
+func (e *ESP32ROM) EraseRegion(offset uint32, size uint32) (err error) {
+	if size == 0 {
+		return fmt.Errorf("Nothing to erase at %X, the size is 0", offset)
+	}
+	if offset%flashSectorSize != 0 || size%flashSectorSize != 0 {
+		return fmt.Errorf("Offset %X and size %X must be multiples of the sector size %X", offset, size, flashSectorSize)
+	}
+	if !e.flashAttached {
+		err = e.AttachSpiFlash()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !e.stubLoaded {
+		return e.eraseRegionROM(offset, size)
+	}
+
+	e.logger.Printf("Erasing %d bytes at %08X", size, offset)
+	_, err = e.CheckExecuteCommand(
+		common.NewEraseRegionCommand(offset, size),
+		eraseTimeout(size, eraseMinimumTimeout),
+		1,
+	)
+	return err
+}
+
+// eraseRegionROM erases through FLASH_BEGIN, which erases the region it is about to write
+func (e *ESP32ROM) eraseRegionROM(offset uint32, size uint32) (err error) {
+	e.logger.Printf("Erasing %d bytes at %08X using FLASH_BEGIN", size, offset)
+	_, err = e.CheckExecuteCommand(
+		e.newBeginFlashCommand(false, e.chip.FlashEraseSize(offset, size), 0, e.flashWriteBlockLength(), offset),
+		eraseTimeout(size, flashBeginMinimumTimeout),
+		1,
+	)
+	return err
+}
+
+// headerFlashSize returns the flash size stated in the header of the bootloader image
+func (e *ESP32ROM) headerFlashSize() (uint32, error) {
+	offset := e.chip.BootloaderOffset()
+	header, err := e.ReadFlash(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	if header[0] != image.Magic && !(header[0] == image.MagicESP8266V2 && e.chip.ImageChipID() == image.ChipIDESP8266) {
+		return 0, fmt.Errorf("No bootloader image found at %X", offset)
+	}
+	img := &image.Image{}
+	img.ChipID = e.chip.ImageChipID()
+	img.FlashSize = image.FlashSize(header[3] & 0xF0)
+	size := img.FlashSizeBytes()
+	if size == 0 {
+		return 0, fmt.Errorf("Unknown flash size %02X in bootloader header", header[3]&0xF0)
+	}
+	return uint32(size), nil
+}
@@ -0,0 +1,70 @@
+package esp32
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func assertErased(t *testing.T, flash []byte, offset uint32, size uint32) {
+	if !bytes.Equal(flash[offset:offset+size], bytes.Repeat([]byte{0xFF}, int(size))) {
+		t.Errorf("Region %X-%X is not erased", offset, offset+size)
+	}
+	if flash[offset+size] == 0xFF || (offset > 0 && flash[offset-1] == 0xFF) {
+		t.Errorf("More than region %X-%X got erased", offset, offset+size)
+	}
+}
+
+func TestEraseRegion(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	for i := range device.Flash {
+		device.Flash[i] = 0x00
+	}
+
+	if err := e.EraseRegion(0x9000, 0x6001); err == nil {
+		t.Errorf("Expected EraseRegion to reject unaligned size")
+	}
+	if err := e.EraseRegion(0x9000, 0); err == nil {
+		t.Errorf("Expected EraseRegion to reject an empty region")
+	}
+	if err := e.EraseRegion(0x9000, 0x6000); err != nil {
+		t.Fatalf("EraseRegion errored with: %v", err)
+	}
+	assertErased(t, device.Flash, 0x9000, 0x6000)
+
+	stub, _ := LoadStub(strings.NewReader(stubJSON))
+	if err := e.RunStub(stub); err != nil {
+		t.Fatalf("RunStub errored with: %v", err)
+	}
+	if err := e.EraseRegion(0x20000, 0x3000); err != nil {
+		t.Fatalf("EraseRegion through stub errored with: %v", err)
+	}
+	assertErased(t, device.Flash, 0x20000, 0x3000)
+}
+
+func TestEraseFlashROM(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	for i := range device.Flash {
+		device.Flash[i] = 0x00
+	}
+	// a blank chip has no bootloader header, the size comes from the JEDEC ID
+	if err := e.EraseFlash(); err != nil {
+		t.Fatalf("EraseFlash errored with: %v", err)
+	}
+	if !bytes.Equal(device.Flash, bytes.Repeat([]byte{0xFF}, len(device.Flash))) {
+		t.Errorf("Flash is not erased completely")
+	}
+
+	for i := range device.Flash {
+		device.Flash[i] = 0x00
+	}
+	device.FlashID = 0xFF40C8
+	if err := e.EraseFlash(); err == nil {
+		t.Errorf("Expected EraseFlash to fail without flash ID and bootloader header")
+	}
+	copy(device.Flash[e.Chip().BootloaderOffset():], []byte{0xE9, 0x03, 0x02, 0x10})
+	if err := e.EraseFlash(); err != nil {
+		t.Fatalf("EraseFlash with the size of the bootloader header errored with: %v", err)
+	}
+	assertErased(t, device.Flash, 0, 2*1024*1024)
+}
@@ -2,9 +2,9 @@ package esp32
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"github.com/fluepke/esptool/common"
-	"github.com/fluepke/esptool/common/serial"
 	"log"
 	"time"
 )
@@ -12,74 +12,108 @@ import (
 const (
 	efuseRegBase    uint = 0x6001a000
 	drRegSysconBase uint = 0x3ff66000
-	macEfuseReg     uint = 0x3f41A044 // ESP32-S2 has special block for MAC efuses
-)
-
-var (
-	flashSizes = map[byte]int{
-		0x00: 1048576,  // 1MB
-		0x10: 2097152,  // 2MB
-		0x20: 4194304,  // 4MB
-		0x30: 8388608,  // 8MB
-		0x40: 16777216, // 16MB
-	}
 )
 
 type ESP32ROM struct {
-	SerialPort     *serial.Port
+	Transport      common.Transport
 	SlipReadWriter *common.SlipReadWriter
+	chip           Chip
 	flashAttached  bool
+	stubLoaded     bool
+	statusLength   int
+	baudrate       uint32
 	logger         *log.Logger
 	defaultTimeout time.Duration
 	defaultRetries int
+	// USBJTAGSerial selects the reset sequence of the USB-Serial/JTAG controller of the
+	// ESP32-S3 and newer chips. Connect sets it if the chip answers to that sequence only.
+	USBJTAGSerial bool
+	// ResetSequence replaces the classic and USB-Serial/JTAG reset sequences if not nil,
+	// see ParseResetStrategy. An empty sequence leaves the chip as it is.
+	ResetSequence ResetSequence
 }
 
-func NewESP32ROM(serialPort *serial.Port, logger *log.Logger) *ESP32ROM {
+// NewESP32ROM creates an ESP32ROM talking to the bootloader through the given transport,
+// e.g. a *serial.Port. The chip is assumed to be an ESP32 until Connect detects it, the
+// number of status bytes in responses is unknown until then.
+func NewESP32ROM(transport common.Transport, logger *log.Logger) *ESP32ROM {
 	return &ESP32ROM{
-		SerialPort:     serialPort,
-		SlipReadWriter: common.NewSlipReadWriter(serialPort, logger),
+		Transport:      transport,
+		SlipReadWriter: common.NewSlipReadWriter(transport, logger),
+		chip:           chips[ChipNameESP32],
+		baudrate:       transport.GetBaudrate(),
+		statusLength:   common.StatusLengthUnknown,
 		logger:         logger,
 		defaultTimeout: 100 * time.Millisecond,
 		defaultRetries: 3,
 	}
 }
 
-func (e *ESP32ROM) Reset() (err error) {
-	// set IO0=HIGH
-	err = e.SerialPort.SetDTR(false)
-	if err != nil {
-		return
+// Reset resets the chip into the bootloader using DTR and RTS
+func (e *ESP32ROM) Reset() error {
+	sequence := e.ResetSequence
+	if sequence == nil {
+		strategy := ResetStrategyClassic
+		if e.USBJTAGSerial {
+			strategy = ResetStrategyUSBJTAGSerial
+		}
+		var err error
+		if sequence, err = ParseResetStrategy(strategy); err != nil {
+			return err
+		}
+	}
+	err := sequence.Run(e.Transport)
+	// the chip is back in the ROM bootloader
+	e.leftLoader()
+	return err
+}
+
+// Connect resets the chip into the bootloader, syncs and detects the chip family.
+// Unless ResetSequence is set and the chip does not answer, the USB-Serial/JTAG reset
+// sequence is tried as well.
+func (e *ESP32ROM) Connect(maxRetries uint) (err error) {
+	err = e.resetAndSync(maxRetries)
+	if err != nil && e.ResetSequence == nil && !e.USBJTAGSerial {
+		e.logger.Print("Retrying with the USB-Serial/JTAG reset sequence")
+		e.USBJTAGSerial = true
+		if err = e.resetAndSync(maxRetries); err != nil {
+			e.USBJTAGSerial = false
+		}
 	}
-	// set EN=LOW, chip in reset
-	err = e.SerialPort.SetRTS(true)
 	if err != nil {
 		return
 	}
+	// the ROM detects the rate the host uses
+	e.baudrate = e.Transport.GetBaudrate()
 
-	time.Sleep(100 * time.Millisecond)
-
-	// set IO0=LOW
-	err = e.SerialPort.SetDTR(true)
+	chip, err := e.detectChip()
 	if err != nil {
 		return
 	}
-	// EN=HIGH, chip out of reset
-	err = e.SerialPort.SetRTS(false)
-
-	time.Sleep(5 * time.Millisecond)
+	e.chip = chip
+	e.statusLength = chip.ROMStatusLength()
+	if usbChip, ok := chip.(usbJTAGSerialChip); ok {
+		// the classic sequence may work on the USB-Serial/JTAG controller by chance, later resets shouldn't rely on that
+		used, err := usbChip.usesUSBJTAGSerial(e)
+		if err != nil {
+			return err
+		}
+		e.USBJTAGSerial = e.USBJTAGSerial || used
+	}
 	return
 }
 
-func (e *ESP32ROM) Connect(maxRetries uint) (err error) {
+func (e *ESP32ROM) resetAndSync(maxRetries uint) (err error) {
 	err = e.Reset()
 	if err != nil {
 		return
 	}
 
-	err = e.SerialPort.Flush()
+	err = e.Transport.Flush()
 	if err != nil {
 		return
 	}
+	e.SlipReadWriter.Discard()
 
 	for i := uint(0); i < maxRetries; i++ {
 		e.logger.Printf("Connecting %d/%d ...\n", i, maxRetries)
@@ -106,7 +140,7 @@ func (e *ESP32ROM) Sync() (err error) {
 }
 
 func (e *ESP32ROM) ReadEfuse(efuseIndex uint) ([4]byte, error) {
-	return e.ReadRegister(efuseRegBase + (4 * efuseIndex))
+	return e.ReadRegister(e.chip.EfuseBase() + (4 * efuseIndex))
 }
 
 func (e *ESP32ROM) ReadRegister(register uint) ([4]byte, error) {
@@ -120,6 +154,25 @@ func (e *ESP32ROM) ReadRegister(register uint) ([4]byte, error) {
 	return response.Value, nil
 }
 
+// WriteRegister sets the bits in mask of register to value and waits for delay afterwards
+func (e *ESP32ROM) WriteRegister(register uint, value uint32, mask uint32, delay time.Duration) error {
+	_, err := e.CheckExecuteCommand(
+		common.NewWriteRegisterCommand(uint32(register), value, mask, uint32(delay/time.Microsecond)),
+		e.defaultTimeout+delay,
+		e.defaultRetries,
+	)
+	return err
+}
+
+// readRegisterUint32 reads a register as a single little endian word
+func (e *ESP32ROM) readRegisterUint32(register uint) (uint32, error) {
+	value, err := e.ReadRegister(register)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(value[:]), nil
+}
+
 func (e *ESP32ROM) ExecuteCommand(command *common.Command, timeout time.Duration) (*common.Response, error) {
 	err := e.SlipReadWriter.Write(command.ToBytes())
 	if err != nil {
@@ -130,11 +183,11 @@ func (e *ESP32ROM) ExecuteCommand(command *common.Command, timeout time.Duration
 		if err != nil {
 			return nil, err
 		}
-		if responseBuf[1] != byte(command.Opcode) {
+		if len(responseBuf) < 2 || responseBuf[1] != byte(command.Opcode) {
 			e.logger.Printf("Opcode did not match %d/%d\n", retryCount, 16)
 			continue
 		} else {
-			return common.NewResponse(responseBuf)
+			return common.NewResponse(responseBuf, e.statusLength)
 		}
 	}
 	return nil, fmt.Errorf("Retrycount exceeded")
@@ -159,9 +212,18 @@ func (e *ESP32ROM) CheckExecuteCommand(command *common.Command, timeout time.Dur
 }
 
 func (e *ESP32ROM) ChangeBaudrate(newBaudrate uint32) error {
+	if !e.supports(common.OpcodeChangeBaudrate) {
+		e.logger.Printf("The %s ROM can't change the baudrate, staying at the current one", e.chip.Name())
+		return nil
+	}
 	e.logger.Printf("Changing baudrate to %d\n", newBaudrate)
+	oldBaudrate := uint32(0)
+	if e.stubLoaded {
+		// the stub wants to know the current baudrate, the ROM expects zero
+		oldBaudrate = e.baudrate
+	}
 	_, err := e.CheckExecuteCommand(
-		common.NewChangeBaudrateCommand(newBaudrate, 0), //e.SerialPort.Config.BaudRate),
+		common.NewChangeBaudrateCommand(newBaudrate, oldBaudrate),
 		e.defaultTimeout,
 		e.defaultRetries,
 	)
@@ -169,21 +231,27 @@ func (e *ESP32ROM) ChangeBaudrate(newBaudrate uint32) error {
 		return err
 	}
 
-	err = e.SerialPort.SetBaudrate(newBaudrate)
+	err = e.Transport.SetBaudrate(newBaudrate)
 	if err != nil {
 		return err
 	}
 
-	e.logger.Printf("Changed baudrate to %d", e.SerialPort.Config.BaudRate)
+	e.baudrate = newBaudrate
+	e.logger.Printf("Changed baudrate to %d", newBaudrate)
 	time.Sleep(10 * time.Millisecond)
-	e.SerialPort.Flush() // get rid of crap sent during baud rate change
+	e.Transport.Flush() // get rid of crap sent during baud rate change
+	e.SlipReadWriter.Discard()
 	return nil
 }
 
 func (e *ESP32ROM) ReadPartitionList() (PartitionList, error) {
+	offset := e.chip.PartitionTableOffset()
+	if offset == 0 {
+		return PartitionList{}, fmt.Errorf("The %s has no partition table", e.chip.Name())
+	}
 	e.logger.Print("Reading partiton table from ESP32")
 
-	bindata, err := e.ReadFlash(uint32(partitionTableOffset), uint32(partitionTableMaxSize))
+	bindata, err := e.ReadFlash(offset, uint32(partitionTableMaxSize))
 
 	if err != nil {
 		return PartitionList{}, fmt.Errorf("Could not read partition table from chip: %v", err)
@@ -0,0 +1,188 @@
+package esp32
+
+import (
+	"bytes"
+	"github.com/fluepke/esptool/common"
+	"github.com/fluepke/esptool/emulator"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+// fakeTransport answers every SLIP frame written to it using the respond callback
+type fakeTransport struct {
+	requests [][]byte
+	pending  bytes.Buffer
+	respond  func(request []byte) [][]byte
+}
+
+func (f *fakeTransport) Write(b []byte) (int, error) {
+	request := bytes.ReplaceAll(b[1:len(b)-1], []byte{common.SlipEscapeChar, 0xDC}, []byte{common.SlipHeader})
+	request = bytes.ReplaceAll(request, []byte{common.SlipEscapeChar, 0xDD}, []byte{common.SlipEscapeChar})
+	f.requests = append(f.requests, request)
+	for _, response := range f.respond(request) {
+		f.pending.Write(common.SlipEncode(response))
+	}
+	return len(b), nil
+}
+
+func (f *fakeTransport) Read(b []byte) (int, error) {
+	if f.pending.Len() == 0 {
+		return 0, nil
+	}
+	return f.pending.Read(b)
+}
+
+func (f *fakeTransport) SetDTR(dtr bool) error             { return nil }
+func (f *fakeTransport) SetRTS(rts bool) error             { return nil }
+func (f *fakeTransport) SetBaudrate(baudrate uint32) error { return nil }
+func (f *fakeTransport) GetBaudrate() uint32               { return 115200 }
+func (f *fakeTransport) Flush() error                      { return nil }
+
+func fakeResponse(opcode common.Opcode, value uint32, data []byte) []byte {
+	response := []byte{byte(common.DirectionResponse), byte(opcode)}
+	response = append(response, common.Uint16ToBytes(uint16(len(data)+4))...)
+	response = append(response, common.Uint32ToBytes(value)...)
+	response = append(response, data...)
+	return append(response, 0, 0, 0, 0)
+}
+
+func newFakeESP32ROM(respond func(request []byte) [][]byte) (*ESP32ROM, *fakeTransport) {
+	transport := &fakeTransport{respond: respond}
+	return NewESP32ROM(transport, log.New(ioutil.Discard, "", 0)), transport
+}
+
+func TestExecuteCommandSkipsStaleResponses(t *testing.T) {
+	e, _ := newFakeESP32ROM(func(request []byte) [][]byte {
+		return [][]byte{
+			fakeResponse(common.OpcodeSync, 0, nil),
+			fakeResponse(common.Opcode(request[1]), 0x12345678, nil),
+		}
+	})
+
+	value, err := e.ReadRegister(drRegSysconBase)
+	if err != nil {
+		t.Fatalf("ReadRegister errored with: %v", err)
+	}
+	if !bytes.Equal(value[:], common.Uint32ToBytes(0x12345678)) {
+		t.Errorf("Expected register value 12345678, received %X", value)
+	}
+}
+
+func TestWriteFlashUncompressed(t *testing.T) {
+	e, transport := newFakeESP32ROM(func(request []byte) [][]byte {
+		return [][]byte{fakeResponse(common.Opcode(request[1]), 0, nil)}
+	})
+
+	data := bytes.Repeat([]byte{0xA5, common.SlipHeader}, 0x280)
+	if err := e.WriteFlash(0x1000, data, false, false, true); err != nil {
+		t.Fatalf("WriteFlash errored with: %v", err)
+	}
+
+	opcodes := []common.Opcode{}
+	for _, request := range transport.requests {
+		opcodes = append(opcodes, common.Opcode(request[1]))
+	}
+	desiredOpcodes := []common.Opcode{common.OpcodeSpiAttachFlash, common.OpcodeFlashBegin, common.OpcodeFlashData, common.OpcodeFlashData}
+	if len(opcodes) != len(desiredOpcodes) {
+		t.Fatalf("Expected opcodes %v, received %v", desiredOpcodes, opcodes)
+	}
+	for index := range desiredOpcodes {
+		if opcodes[index] != desiredOpcodes[index] {
+			t.Errorf("Expected opcode %s at index %d, received %s", desiredOpcodes[index], index, opcodes[index])
+		}
+	}
+
+	written := []byte{}
+	for _, request := range transport.requests[2:4] {
+		written = append(written, request[8+16:]...)
+	}
+	if !bytes.Equal(written[:len(data)], data) {
+		t.Errorf("Written data does not match")
+	}
+	if !bytes.Equal(written[len(data):], bytes.Repeat([]byte{0xFF}, 2*int(blockLengthWriteMax)-len(data))) {
+		t.Errorf("Last block is not padded with 0xFF")
+	}
+}
+
+func newEmulatedESP32ROM(t *testing.T) (*ESP32ROM, *emulator.Device) {
+	device := emulator.NewDevice(4*1024*1024, nil)
+	e := NewESP32ROM(device, log.New(ioutil.Discard, "", 0))
+	if err := e.Connect(3); err != nil {
+		t.Fatalf("Connect errored with: %v", err)
+	}
+	return e, device
+}
+
+func TestChipInformation(t *testing.T) {
+	e, _ := newEmulatedESP32ROM(t)
+
+	mac, err := e.GetChipMAC()
+	if err != nil {
+		t.Fatalf("GetChipMAC errored with: %v", err)
+	}
+	if mac != "24:6f:28:92:ef:20" {
+		t.Errorf("Expected MAC 24:6f:28:92:ef:20, received %s", mac)
+	}
+
+	description, err := e.GetChipDescription()
+	if err != nil {
+		t.Fatalf("GetChipDescription errored with: %v", err)
+	}
+	if description.Package != "ESP32D0WDQ6" || description.Revision != 1 || description.Chip.Name() != ChipNameESP32 {
+		t.Errorf("Expected ESP32D0WDQ6 (revision 1), received %s", description.String())
+	}
+
+	features, err := e.GetFeatures()
+	if err != nil {
+		t.Fatalf("GetFeatures errored with: %v", err)
+	}
+	for _, feature := range []Feature{WiFi, Bluetooth, VRefCalibrationEFuse, CodingSchemeNone} {
+		if !features[feature] {
+			t.Errorf("Expected feature %s in %s", feature.String(), features.String())
+		}
+	}
+}
+
+func TestDetectChip(t *testing.T) {
+	for _, test := range []struct {
+		magic uint32
+		name  string
+		err   string
+	}{
+		{0x00f01d83, ChipNameESP32, ""},
+		{0x000007c6, ChipNameESP32S2, ""},
+		{0x00000009, ChipNameESP32S3, ""},
+		{0x4881606f, ChipNameESP32C3, ""},
+		{0x1b31506f, ChipNameESP32C3, ""},
+		{0x2ce0806f, ChipNameESP32C6, ""},
+		{0xd7b73e80, "", "This is an ESP32-H2"},
+		{0x12345678, "", "Unknown chip with magic value 12345678"},
+	} {
+		device := emulator.NewDevice(4*1024*1024, nil)
+		device.Registers[uint32(chipDetectMagicReg)] = test.magic
+		e := NewESP32ROM(device, log.New(ioutil.Discard, "", 0))
+		err := e.Connect(3)
+		if test.err == "" {
+			if err != nil || e.Chip().Name() != test.name {
+				t.Errorf("Expected magic %08X to be detected as %s, got %s: %v", test.magic, test.name, e.Chip().Name(), err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected magic %08X to fail with '%s', got: %v", test.magic, test.err, err)
+		}
+	}
+}
+
+func TestChangeBaudrate(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	if err := e.ChangeBaudrate(921600); err != nil {
+		t.Fatalf("ChangeBaudrate errored with: %v", err)
+	}
+	if device.Baudrate != 921600 {
+		t.Errorf("Expected device baudrate 921600, received %d", device.Baudrate)
+	}
+	if err := e.Sync(); err != nil {
+		t.Errorf("Sync after baudrate change errored with: %v", err)
+	}
+}
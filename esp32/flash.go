@@ -3,20 +3,25 @@ package esp32
 import (
 	"bytes"
 	"compress/zlib"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"github.com/fluepke/esptool/common"
+	"io"
 	"time"
 )
 
 const blockLengthReadMax uint32 = 64 // TODO check if this value taken from the esptool.py is really true
 const blockLengthWriteMax uint32 = 0x400
+const blockLengthWriteMaxStub uint32 = 0x4000
+const readFlashSectorSize uint32 = 0x1000
+const readFlashMaxInFlight uint32 = 64
+const readFlashPacketTimeout = 3 * time.Second
+const md5TimeoutPerMB = 8 * time.Second
+const md5MinimumTimeout = 3 * time.Second
 
 func (e *ESP32ROM) AttachSpiFlash() (err error) {
-	_, err = e.CheckExecuteCommand(
-		common.NewAttachSpiFlashCommand(),
-		e.defaultTimeout,
-		e.defaultRetries,
-	)
+	err = e.chip.AttachSpiFlash(e)
 	if err != nil {
 		return err
 	}
@@ -25,37 +30,159 @@ func (e *ESP32ROM) AttachSpiFlash() (err error) {
 	return
 }
 
+// ReadFlash reads size bytes of flash starting at offset into memory
 func (e *ESP32ROM) ReadFlash(offset uint32, size uint32) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	err := e.ReadFlashTo(offset, size, buf)
+	return buf.Bytes(), err
+}
+
+// ReadFlashTo reads size bytes of flash starting at offset and streams them to writer.
+// With the stub loaded the fast streaming protocol is used and verified by MD5.
+func (e *ESP32ROM) ReadFlashTo(offset uint32, size uint32, writer io.Writer) error {
+	if !e.supports(common.OpcodeReadFlash) {
+		return fmt.Errorf("The %s ROM can't read flash, load the flasher stub %s", e.chip.Name(), e.chip.StubName())
+	}
 	if !e.flashAttached {
 		err := e.AttachSpiFlash()
 		if err != nil {
-			return []byte{}, err
+			return err
 		}
 	}
 
-	receivedData := make([]byte, 0)
+	if e.stubLoaded {
+		return e.readFlashStub(offset, size, writer)
+	}
+
+	received := uint32(0)
 	for {
-		// e.logger.Printf("%d of %d\n", len(receivedData), size)
-		if len(receivedData) >= int(size) {
-			return receivedData, nil
+		// e.logger.Printf("%d of %d\n", received, size)
+		if received >= size {
+			return nil
 		}
 
-		blockLength := size - uint32(len(receivedData))
+		blockLength := size - received
 		if blockLength > blockLengthReadMax {
 			blockLength = blockLengthReadMax
 		}
 
 		response, err := e.CheckExecuteCommand(
-			common.NewReadFlashCommand(offset+uint32(len(receivedData)), blockLength),
+			common.NewReadFlashCommand(offset+received, blockLength),
 			e.defaultTimeout,
 			e.defaultRetries,
 		)
 		if err != nil {
-			return receivedData, err
+			return err
+		}
+		if uint32(len(response.Data)) < blockLength {
+			return fmt.Errorf("Expected %d bytes of flash data, received %d", blockLength, len(response.Data))
 		}
 
-		receivedData = append(receivedData, response.Data[:blockLength]...)
+		if _, err = writer.Write(response.Data[:blockLength]); err != nil {
+			return err
+		}
+		received += blockLength
+	}
+}
+
+// flashReader reads flash sequentially in sector sized chunks
+type flashReader struct {
+	rom    *ESP32ROM
+	offset uint32
+	end    uint32
+	buffer []byte
+}
+
+// NewFlashReader returns a reader for size bytes of flash starting at offset.
+// Flash is read in chunks of one sector, so small reads don't each cost a command.
+func (e *ESP32ROM) NewFlashReader(offset uint32, size uint32) io.Reader {
+	return &flashReader{
+		rom:    e,
+		offset: offset,
+		end:    offset + size,
+	}
+}
+
+func (f *flashReader) Read(p []byte) (int, error) {
+	if len(f.buffer) == 0 {
+		if f.offset >= f.end {
+			return 0, io.EOF
+		}
+		chunkLength := f.end - f.offset
+		if chunkLength > readFlashSectorSize {
+			chunkLength = readFlashSectorSize
+		}
+		data, err := f.rom.ReadFlash(f.offset, chunkLength)
+		if err != nil {
+			return 0, err
+		}
+		f.offset += chunkLength
+		f.buffer = data
+	}
+	n := copy(p, f.buffer)
+	f.buffer = f.buffer[n:]
+	return n, nil
+}
+
+func (e *ESP32ROM) readFlashStub(offset uint32, size uint32, writer io.Writer) error {
+	e.logger.Printf("Reading %d bytes from %08X", size, offset)
+	// a retry would start a second stream, so the command is sent only once
+	_, err := e.CheckExecuteCommand(
+		common.NewReadFlashFastCommand(offset, size, readFlashSectorSize, readFlashMaxInFlight),
+		e.defaultTimeout,
+		1,
+	)
+	if err != nil {
+		return err
+	}
+
+	digest := md5.New()
+	received := uint32(0)
+	for received < size {
+		packet, err := e.SlipReadWriter.Read(readFlashPacketTimeout)
+		if err != nil {
+			return fmt.Errorf("Flash read aborted after %d of %d bytes: %v", received, size, err)
+		}
+		if uint32(len(packet)) > size-received {
+			return fmt.Errorf("Received %d bytes more than requested", uint32(len(packet))-(size-received))
+		}
+		received += uint32(len(packet))
+		digest.Write(packet)
+		if _, err = writer.Write(packet); err != nil {
+			return err
+		}
+		if err = e.SlipReadWriter.Write(common.Uint32ToBytes(received)); err != nil {
+			return err
+		}
+	}
+
+	expectedDigest, err := e.SlipReadWriter.Read(readFlashPacketTimeout)
+	if err != nil {
+		return fmt.Errorf("Did not receive MD5 of flash contents: %v", err)
+	}
+	if actualDigest := digest.Sum(nil); !bytes.Equal(expectedDigest, actualDigest) {
+		return fmt.Errorf("MD5 of flash contents does not match, device sent %x, received data has %x", expectedDigest, actualDigest)
+	}
+	e.logger.Printf("Read %d bytes, MD5 verified", received)
+	return nil
+}
+
+// newBeginFlashCommand returns a FLASH_BEGIN or, if compressed is set, a FLASH_DEFL_BEGIN command.
+// ROMs supporting encrypted writes get the additional flag, which is always cleared.
+func (e *ESP32ROM) newBeginFlashCommand(compressed bool, eraseSize uint32, numBlocks uint32, blockSize uint32, offset uint32) *common.Command {
+	command := common.NewBeginFlashCommand(eraseSize, numBlocks, blockSize, offset)
+	if compressed {
+		command = common.NewBeginFlashDeflCommand(eraseSize, numBlocks, blockSize, offset)
+	}
+	if !e.stubLoaded && e.chip.SupportsEncryptedFlash() {
+		command.Data = append(command.Data, common.Uint32ToBytes(0)...)
 	}
+	return command
+}
+
+// flashWriteBlockLength returns the FLASH_DATA block size supported by the running loader
+func (e *ESP32ROM) flashWriteBlockLength() uint32 {
+	return e.chip.FlashWriteSize(e.stubLoaded)
 }
 
 func compressImage(data []byte) ([]byte, error) {
@@ -67,7 +194,77 @@ func compressImage(data []byte) ([]byte, error) {
 	return b.Bytes(), err
 }
 
-func (e *ESP32ROM) WriteFlash(offset uint32, data []byte, useCompression bool) (err error) {
+// FlashMD5 returns the MD5 digest of size bytes of flash starting at offset, computed on the chip
+func (e *ESP32ROM) FlashMD5(offset uint32, size uint32) ([]byte, error) {
+	if !e.supports(common.OpcodeSpiFlashMd5) {
+		return nil, fmt.Errorf("The %s ROM can't calculate MD5 digests, load the flasher stub", e.chip.Name())
+	}
+	if !e.flashAttached {
+		err := e.AttachSpiFlash()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := e.CheckExecuteCommand(
+		common.NewSpiFlashMD5Command(offset, size),
+		md5Timeout(size),
+		e.defaultRetries,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stub sends the raw digest, the ROM sends it hex encoded
+	if len(response.Data) == md5.Size {
+		return response.Data, nil
+	}
+	if len(response.Data) != 2*md5.Size {
+		return nil, fmt.Errorf("Invalid MD5 response length %d", len(response.Data))
+	}
+	return hex.DecodeString(string(response.Data))
+}
+
+func md5Timeout(size uint32) time.Duration {
+	timeout := time.Duration(float64(md5TimeoutPerMB) * float64(size) / (1024 * 1024))
+	if timeout < md5MinimumTimeout {
+		return md5MinimumTimeout
+	}
+	return timeout
+}
+
+// VerifyFlash compares the MD5 digest of the flash region starting at offset with the digest of data
+func (e *ESP32ROM) VerifyFlash(offset uint32, data []byte) error {
+	actual, err := e.FlashMD5(offset, uint32(len(data)))
+	if err != nil {
+		return fmt.Errorf("Could not verify flash contents: %v", err)
+	}
+	expected := md5.Sum(data)
+	if !bytes.Equal(actual, expected[:]) {
+		return fmt.Errorf("Verification failed: MD5 of flash region %08X-%08X is %x, expected %x", offset, offset+uint32(len(data)), actual, expected)
+	}
+	e.logger.Printf("Verified %d bytes at %08X", len(data), offset)
+	return nil
+}
+
+// WriteFlash writes data to flash at offset. If verify is set, the written region is checked
+// against the MD5 digest of data afterwards. Unless force is set, data written to the bootloader,
+// partition table or an app partition is validated first, see ValidateFlashRegions.
+func (e *ESP32ROM) WriteFlash(offset uint32, data []byte, useCompression bool, verify bool, force bool) (err error) {
+	if !force {
+		err = e.ValidateFlashRegions([]FlashRegion{{Name: "data", Offset: offset, Data: data}})
+		if err != nil {
+			return err
+		}
+	}
+	return e.writeFlash(offset, data, useCompression, verify, func(sent uint32, total uint32) {
+		fmt.Printf("%d of %d - %.2f \n", sent, total, float64(sent)/float64(total)*100.0)
+	})
+}
+
+// writeFlash does the actual work for WriteFlash, reporting progress in bytes of transferred
+// (possibly compressed) data to progress before each block
+func (e *ESP32ROM) writeFlash(offset uint32, data []byte, useCompression bool, verify bool, progress func(sent uint32, total uint32)) (err error) {
 	if !e.flashAttached {
 		err = e.AttachSpiFlash()
 		if err != nil {
@@ -75,9 +272,18 @@ func (e *ESP32ROM) WriteFlash(offset uint32, data []byte, useCompression bool) (
 		}
 	}
 
+	if useCompression && !e.supports(common.OpcodeFlashDeflBegin) {
+		e.logger.Printf("The %s ROM does not support compressed writes, writing uncompressed", e.chip.Name())
+		useCompression = false
+	}
+	if verify && !e.supports(common.OpcodeSpiFlashMd5) {
+		return fmt.Errorf("The %s ROM can't calculate MD5 digests to verify written data, load the flasher stub %s or pass -flash.verify=false", e.chip.Name(), e.chip.StubName())
+	}
+
 	var remaining []byte
+	writeBlockLength := e.flashWriteBlockLength()
 
-	numBlocks := (uint32(len(data)) + blockLengthWriteMax - 1) / blockLengthWriteMax
+	numBlocks := (uint32(len(data)) + writeBlockLength - 1) / writeBlockLength
 	e.logger.Print("Start Erase procedure")
 
 	if useCompression {
@@ -86,33 +292,44 @@ func (e *ESP32ROM) WriteFlash(offset uint32, data []byte, useCompression bool) (
 			return err
 		}
 		uncompressedNumBlocks := numBlocks
-		numBlocks = (uint32(len(remaining)) + blockLengthWriteMax - 1) / blockLengthWriteMax
+		numBlocks = (uint32(len(remaining)) + writeBlockLength - 1) / writeBlockLength
 		e.logger.Printf("Compressed %d bytes to %d bytes. Ration = %.1f", len(data), len(remaining), float64(len(remaining))/float64(len(data)))
+		// the ROM erases whole blocks, the stub takes the exact size
+		eraseSize := uncompressedNumBlocks * writeBlockLength
+		if e.stubLoaded {
+			eraseSize = uint32(len(data))
+		}
 		_, err = e.CheckExecuteCommand(
-			common.NewBeginFlashDeflCommand(
-				uint32(uncompressedNumBlocks)*blockLengthWriteMax,
+			e.newBeginFlashCommand(
+				true,
+				eraseSize,
 				uint32(numBlocks),
-				blockLengthWriteMax,
+				writeBlockLength,
 				offset,
 			),
-			10*time.Second,
+			eraseTimeout(eraseSize, flashBeginMinimumTimeout),
 			e.defaultRetries)
 	} else {
 		remaining = make([]byte, len(data))
 		copy(remaining, data)
+		eraseSize := uint32(len(data))
+		if !e.stubLoaded {
+			eraseSize = e.chip.FlashEraseSize(offset, eraseSize)
+		}
 		_, err = e.CheckExecuteCommand(
-			common.NewBeginFlashCommand(
-				uint32(len(data)),
+			e.newBeginFlashCommand(
+				false,
+				eraseSize,
 				uint32(numBlocks),
-				blockLengthWriteMax,
+				writeBlockLength,
 				offset,
 			),
-			10*time.Second,
+			eraseTimeout(uint32(len(data)), flashBeginMinimumTimeout),
 			e.defaultRetries,
 		)
 	}
 
-	e.logger.Printf("Block size is %d, block count is %d", blockLengthWriteMax, numBlocks)
+	e.logger.Printf("Block size is %d, block count is %d", writeBlockLength, numBlocks)
 	if err != nil {
 		return err
 	}
@@ -129,16 +346,16 @@ func (e *ESP32ROM) WriteFlash(offset uint32, data []byte, useCompression bool) (
 		if sent >= total {
 			break
 		}
-		fmt.Printf("%d of %d - %.2f \n", sent, total, float64(sent)/float64(total)*100.0)
+		progress(sent, total)
 
 		blockLength := uint32(total - sent)
-		if blockLength > blockLengthWriteMax {
-			blockLength = blockLengthWriteMax
+		if blockLength > writeBlockLength {
+			blockLength = writeBlockLength
 		}
 		block := remaining[sent : sent+blockLength]
 
-		if !useCompression && blockLength < blockLengthWriteMax {
-			block = append(block, bytes.Repeat([]byte{0xFF}, int(blockLengthWriteMax-blockLength))...)
+		if !useCompression && blockLength < writeBlockLength {
+			block = append(block, bytes.Repeat([]byte{0xFF}, int(writeBlockLength-blockLength))...)
 		}
 
 		for retryCount := 0; retryCount < 3; retryCount++ {
@@ -180,11 +397,24 @@ func (e *ESP32ROM) WriteFlash(offset uint32, data []byte, useCompression bool) (
 		sent += blockLength
 	}
 
-	//	_, err = e.CheckExecuteCommand(
-	//		common.NewFlashEndCommand(false),
-	//		e.defaultTimeout,
-	//		e.defaultRetries,
-	//	)
+	// the ROM loader would leave download mode on FLASH_END, it has written every block already
+	if e.stubLoaded {
+		endCommand := common.NewFlashEndCommand(false)
+		if useCompression {
+			endCommand = common.NewFlashDeflEndCommand(false)
+		}
+		_, err = e.CheckExecuteCommand(
+			endCommand,
+			e.defaultTimeout,
+			e.defaultRetries,
+		)
+		if err != nil {
+			return err
+		}
+	}
 
-	return err
+	if verify {
+		return e.VerifyFlash(offset, data)
+	}
+	return nil
 }
@@ -0,0 +1,171 @@
+package esp32
+
+import (
+	"fmt"
+)
+
+const (
+	spiRegBase     uint = 0x3ff42000 // SPI1, which is connected to the flash chip
+	spiCmdReg      uint = spiRegBase + 0x00
+	spiUsrReg      uint = spiRegBase + 0x1c
+	spiUsr1Reg     uint = spiRegBase + 0x20
+	spiUsr2Reg     uint = spiRegBase + 0x24
+	spiMosiDlenReg uint = spiRegBase + 0x28
+	spiMisoDlenReg uint = spiRegBase + 0x2c
+	spiW0Reg       uint = spiRegBase + 0x80
+
+	spiCmdUsr     uint32 = 1 << 18
+	spiUsrCommand uint32 = 1 << 31
+	spiUsrMiso    uint32 = 1 << 28
+
+	spiUsr1MisoBitLenShift  = 8
+	spiUsr2CommandBitLength = 7 // command length in bits minus one
+	spiFlashCommandRDID     = 0x9F
+	spiCommandPollCount     = 10
+)
+
+// runSpiFlashCommand sends command to the flash chip through the SPI peripheral and
+// returns the first readBits bits of the response
+func (e *ESP32ROM) runSpiFlashCommand(command uint32, readBits uint32) (uint32, error) {
+	if !e.flashAttached {
+		err := e.AttachSpiFlash()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	spi := e.chip.SpiRegisters()
+	oldUsr, err := e.readRegisterUint32(spi.Usr)
+	if err != nil {
+		return 0, err
+	}
+	oldUsr2, err := e.readRegisterUint32(spi.Usr2)
+	if err != nil {
+		return 0, err
+	}
+
+	type registerWrite struct {
+		register uint
+		value    uint32
+	}
+	writes := []registerWrite{
+		{spi.MosiDlen, 0},
+		{spi.MisoDlen, readBits - 1},
+	}
+	if spi.MisoDlen == 0 {
+		// chips without data length registers take them from USR1
+		writes = []registerWrite{{spi.Usr1, (readBits - 1) << spiUsr1MisoBitLenShift}}
+	}
+	writes = append(writes, []registerWrite{
+		{spi.Usr, spiUsrCommand | spiUsrMiso},
+		{spi.Usr2, spiUsr2CommandBitLength<<28 | command},
+		{spi.W0, 0},
+		{spi.Cmd, spiCmdUsr},
+	}...)
+	for _, write := range writes {
+		err = e.WriteRegister(write.register, write.value, 0xFFFFFFFF, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	done := false
+	for i := 0; i < spiCommandPollCount && !done; i++ {
+		cmd, err := e.readRegisterUint32(spi.Cmd)
+		if err != nil {
+			return 0, err
+		}
+		done = cmd&spiCmdUsr == 0
+	}
+	if !done {
+		return 0, fmt.Errorf("SPI flash command %02X did not complete", command)
+	}
+
+	result, err := e.readRegisterUint32(spi.W0)
+	if err != nil {
+		return 0, err
+	}
+	if err = e.WriteRegister(spi.Usr, oldUsr, 0xFFFFFFFF, 0); err != nil {
+		return 0, err
+	}
+	if err = e.WriteRegister(spi.Usr2, oldUsr2, 0xFFFFFFFF, 0); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+var flashManufacturers = map[byte]string{
+	0x01: "Spansion",
+	0x0B: "XTX",
+	0x1C: "EON",
+	0x1F: "Adesto",
+	0x20: "XMC",
+	0x5E: "Zbit",
+	0x68: "Boya",
+	0x85: "Puya",
+	0x8C: "ESMT",
+	0x9D: "ISSI",
+	0xA1: "Fudan",
+	0xBA: "Zetta",
+	0xBF: "SST",
+	0xC2: "Macronix",
+	0xC8: "GigaDevice",
+	0xEF: "Winbond",
+}
+
+// FlashID is the JEDEC ID of a SPI flash chip
+type FlashID struct {
+	Manufacturer byte
+	// Device is the memory type in the upper and the capacity in the lower byte
+	Device uint16
+	// Size is the capacity in bytes or 0 if it can't be decoded
+	Size int
+}
+
+// ManufacturerName looks up the manufacturer in a table of common flash vendors
+func (f *FlashID) ManufacturerName() string {
+	name, found := flashManufacturers[f.Manufacturer]
+	if found {
+		return name
+	}
+	return "unknown"
+}
+
+func (f *FlashID) String() string {
+	size := "unknown size"
+	if f.Size > 0 {
+		size = fmt.Sprintf("%dKB", f.Size/1024)
+	}
+	return fmt.Sprintf("%s (%02X), device %04X, %s", f.ManufacturerName(), f.Manufacturer, f.Device, size)
+}
+
+// GetFlashID reads the JEDEC ID of the flash chip using the RDID command
+func (e *ESP32ROM) GetFlashID() (*FlashID, error) {
+	id, err := e.runSpiFlashCommand(spiFlashCommandRDID, 24)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read flash ID: %v", err)
+	}
+	// the ID arrives as manufacturer, memory type, capacity
+	flashID := &FlashID{
+		Manufacturer: byte(id),
+		Device:       uint16(byte(id>>8))<<8 | uint16(byte(id>>16)),
+	}
+	capacity := byte(id >> 16)
+	if capacity >= 0x12 && capacity <= 0x18 {
+		flashID.Size = 1 << capacity
+	}
+	return flashID, nil
+}
+
+// DetectFlashSize returns the flash size encoded in the capacity byte of the JEDEC ID
+func (e *ESP32ROM) DetectFlashSize() (int, error) {
+	flashID, err := e.GetFlashID()
+	if err != nil {
+		return 0, err
+	}
+	if flashID.Size == 0 {
+		return 0, fmt.Errorf("Unknown flash capacity in flash ID %s", flashID.String())
+	}
+	e.logger.Printf("Detected flash size %d", flashID.Size)
+	return flashID.Size, nil
+}
@@ -0,0 +1,33 @@
+package esp32
+
+import (
+	"testing"
+)
+
+func TestGetFlashID(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	device.FlashID = 0x1740EF
+
+	flashID, err := e.GetFlashID()
+	if err != nil {
+		t.Fatalf("GetFlashID errored with: %v", err)
+	}
+	if flashID.Manufacturer != 0xEF || flashID.ManufacturerName() != "Winbond" {
+		t.Errorf("Expected Winbond (EF), got %s", flashID.String())
+	}
+	if flashID.Device != 0x4017 {
+		t.Errorf("Expected device 4017, got %04X", flashID.Device)
+	}
+	if flashID.Size != 8*1024*1024 {
+		t.Errorf("Expected 8MB, got %d bytes", flashID.Size)
+	}
+	// the SPI registers have to be restored
+	if usr2 := device.Registers[0x3ff42024]; usr2 != 0 {
+		t.Errorf("SPI_USR2 was not restored, got %08X", usr2)
+	}
+
+	device.FlashID = 0xFF40C8
+	if _, err = e.DetectFlashSize(); err == nil {
+		t.Errorf("Expected DetectFlashSize to fail for unknown capacity")
+	}
+}
@@ -0,0 +1,83 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/image"
+)
+
+const (
+	// FlashParameterKeep leaves a flash parameter in the image header unchanged
+	FlashParameterKeep = "keep"
+	// FlashSizeDetect sets the flash size to the one detected on the chip
+	FlashSizeDetect = "detect"
+)
+
+// PatchFlashParameters rewrites SPI flash mode, frequency and size in the header of the
+// bootloader image among regions, like esptool.py does. Parameters set to FlashParameterKeep
+// stay unchanged, a size of FlashSizeDetect is replaced by the result of DetectFlashSize.
+// Checksum and SHA-256 of the image are recalculated. If all parameters are FlashParameterKeep,
+// the regions are left alone and need not hold an image at all.
+func (e *ESP32ROM) PatchFlashParameters(regions []FlashRegion, mode string, frequency string, size string) (err error) {
+	if mode == FlashParameterKeep && frequency == FlashParameterKeep && size == FlashParameterKeep {
+		return nil
+	}
+	var spiMode image.SpiMode
+	if mode != FlashParameterKeep {
+		if spiMode, err = image.ParseSpiMode(mode); err != nil {
+			return err
+		}
+	}
+	var flashFrequency image.FlashFrequency
+	if frequency != FlashParameterKeep {
+		if flashFrequency, err = image.ParseFlashFrequency(frequency); err != nil {
+			return err
+		}
+	}
+	var flashSize image.FlashSize
+	if size != FlashParameterKeep && size != FlashSizeDetect {
+		if flashSize, err = image.ParseFlashSize(size); err != nil {
+			return err
+		}
+	}
+
+	if e.chip.ImageChipID() == image.ChipIDESP8266 {
+		return fmt.Errorf("Changing the flash parameters of %s images is not supported", e.chip.Name())
+	}
+
+	for index := range regions {
+		region := &regions[index]
+		if region.Offset != e.chip.BootloaderOffset() {
+			continue
+		}
+		img, err := image.Parse(region.Data)
+		if err == nil {
+			err = img.Verify()
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot change flash parameters of region %s: %v", region.String(), err)
+		}
+
+		if mode != FlashParameterKeep {
+			img.SpiMode = spiMode
+		}
+		if frequency != FlashParameterKeep {
+			img.FlashFrequency = flashFrequency
+		}
+		if size == FlashSizeDetect {
+			detectedSize, err := e.DetectFlashSize()
+			if err != nil {
+				return err
+			}
+			if flashSize, err = image.FlashSizeFromBytes(detectedSize); err != nil {
+				return err
+			}
+		}
+		if size != FlashParameterKeep {
+			img.FlashSize = flashSize
+		}
+
+		region.Data = append(img.Bytes(), region.Data[img.Length:]...)
+		e.logger.Printf("Set flash parameters of region %s to %s, %s, %s", region.String(), img.SpiMode.String(), img.FlashFrequency.String(), img.FlashSize.String())
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package esp32
+
+import (
+	"bytes"
+	"github.com/fluepke/esptool/image"
+	"testing"
+)
+
+func TestPatchFlashParameters(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	device.FlashID = 0x174016 // 8MB
+
+	bootloader := buildTestImage(image.ChipIDESP32, 0)
+	app := bytes.Repeat([]byte{0x22}, 0x100)
+	regions := []FlashRegion{
+		{Name: "bootloader", Offset: 0x1000, Data: bootloader},
+		{Name: "app", Offset: 0x10000, Data: app},
+	}
+	if err := e.PatchFlashParameters(regions, "qio", FlashParameterKeep, FlashSizeDetect); err != nil {
+		t.Fatalf("PatchFlashParameters errored with: %v", err)
+	}
+
+	img, err := image.Parse(regions[0].Data)
+	if err != nil {
+		t.Fatalf("Parsing patched bootloader failed: %v", err)
+	}
+	if img.SpiMode != image.SpiModeQIO || img.FlashSize != image.FlashSize8MB || img.FlashFrequency != image.FlashFrequency40M {
+		t.Errorf("Unexpected flash settings %v, %v, %v", img.SpiMode, img.FlashSize, img.FlashFrequency)
+	}
+	if err = img.Verify(); err != nil {
+		t.Errorf("Patched bootloader failed verification: %v", err)
+	}
+	if !bytes.Equal(regions[1].Data, app) {
+		t.Errorf("Region outside the bootloader was modified")
+	}
+
+	if err = e.PatchFlashParameters(regions, "fast", FlashParameterKeep, FlashParameterKeep); err == nil {
+		t.Errorf("Expected an error for an invalid flash mode")
+	}
+}
+
+func TestPatchFlashParametersKeep(t *testing.T) {
+	e, _ := newEmulatedESP32ROM(t)
+	blob := bytes.Repeat([]byte{0xEA, 0x55}, 0x80)
+	regions := []FlashRegion{{Name: "blob", Offset: 0x1000, Data: blob}}
+	if err := e.PatchFlashParameters(regions, FlashParameterKeep, FlashParameterKeep, FlashParameterKeep); err != nil {
+		t.Errorf("Keeping the flash parameters of a non-image region errored with: %v", err)
+	}
+	if !bytes.Equal(regions[0].Data, blob) {
+		t.Errorf("Keeping the flash parameters modified the region")
+	}
+	if err := e.PatchFlashParameters(regions, "dio", FlashParameterKeep, FlashParameterKeep); err == nil {
+		t.Errorf("Expected changing the flash mode of a non-image region to fail")
+	}
+
+	e, _ = newEmulatedESP8266(t)
+	img := &image.Image{}
+	img.Magic = image.Magic
+	img.ChipID = image.ChipIDESP8266
+	img.Segments = []image.Segment{{LoadAddress: 0x40100000, Data: []byte{1, 2, 3, 4}}}
+	for _, data := range [][]byte{img.Bytes(), blob} {
+		regions = []FlashRegion{{Name: "bootloader", Offset: 0x0, Data: data}}
+		if err := e.PatchFlashParameters(regions, FlashParameterKeep, FlashParameterKeep, FlashParameterKeep); err != nil {
+			t.Errorf("Keeping the flash parameters on the ESP8266 errored with: %v", err)
+		}
+		if !bytes.Equal(regions[0].Data, data) {
+			t.Errorf("Keeping the flash parameters on the ESP8266 modified the region")
+		}
+	}
+}
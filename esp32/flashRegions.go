@@ -0,0 +1,78 @@
+package esp32
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FlashRegion is a chunk of data to be written to flash at Offset
+type FlashRegion struct {
+	// Name describes the region in messages, e.g. the file the data came from
+	Name   string
+	Offset uint32
+	Data   []byte
+}
+
+func (f *FlashRegion) String() string {
+	return fmt.Sprintf("'%s' (%08X-%08X)", f.Name, f.Offset, f.end())
+}
+
+func (f *FlashRegion) end() uint32 {
+	return f.Offset + uint32(len(f.Data))
+}
+
+// sectorEnd returns the end of the last sector that is erased when writing the region
+func (f *FlashRegion) sectorEnd() uint32 {
+	return (f.end() + flashSectorSize - 1) / flashSectorSize * flashSectorSize
+}
+
+// CheckFlashRegions makes sure no two regions touch the same flash sector, because
+// erasing the sector for one region would destroy the data of the other
+func CheckFlashRegions(regions []FlashRegion) error {
+	sorted := make([]FlashRegion, len(regions))
+	copy(sorted, regions)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	for index := 1; index < len(sorted); index++ {
+		previous, current := &sorted[index-1], &sorted[index]
+		if current.Offset/flashSectorSize*flashSectorSize < previous.sectorEnd() {
+			return fmt.Errorf("Regions %s and %s overlap or share a flash sector", previous.String(), current.String())
+		}
+	}
+	return nil
+}
+
+// WriteFlashRegions writes multiple regions in one session. All regions are checked for
+// overlaps and, unless force is set, validated before anything is erased. Progress is
+// reported across all regions.
+func (e *ESP32ROM) WriteFlashRegions(regions []FlashRegion, useCompression bool, verify bool, force bool) error {
+	if err := CheckFlashRegions(regions); err != nil {
+		return err
+	}
+	if !force {
+		if err := e.ValidateFlashRegions(regions); err != nil {
+			return err
+		}
+	}
+
+	total := 0
+	for _, region := range regions {
+		total += len(region.Data)
+	}
+
+	done := 0
+	for index, region := range regions {
+		e.logger.Printf("Writing region %d/%d %s", index+1, len(regions), region.String())
+		err := e.writeFlash(region.Offset, region.Data, useCompression, verify, func(sent uint32, regionTotal uint32) {
+			// sent counts transferred (possibly compressed) bytes, scale it to the uncompressed size
+			current := done + int(float64(sent)/float64(regionTotal)*float64(len(region.Data)))
+			fmt.Printf("%d of %d - %.2f \n", current, total, float64(current)/float64(total)*100.0)
+		})
+		if err != nil {
+			return fmt.Errorf("Writing region %s failed: %v", region.String(), err)
+		}
+		done += len(region.Data)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package esp32
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func assertWriteReadFlash(t *testing.T, offset uint32, data []byte, useCompression bool) {
+	e, device := newEmulatedESP32ROM(t)
+
+	if err := e.WriteFlash(offset, data, useCompression, true, false); err != nil {
+		t.Fatalf("WriteFlash errored with: %v", err)
+	}
+	if !bytes.Equal(device.Flash[offset:int(offset)+len(data)], data) {
+		t.Errorf("Emulated flash does not contain the written data")
+	}
+
+	readData, err := e.ReadFlash(offset, uint32(len(data)))
+	if err != nil {
+		t.Fatalf("ReadFlash errored with: %v", err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Errorf("Data read back does not match the written data")
+	}
+}
+
+func TestWriteReadFlash(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	assertWriteReadFlash(t, 0x10000, data, false)
+	assertWriteReadFlash(t, 0x10000, data, true)
+}
+
+func TestFlashReader(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(2)).Read(data)
+	copy(device.Flash[0x10000:], data)
+
+	readData, err := ioutil.ReadAll(e.NewFlashReader(0x10000, uint32(len(data))))
+	if err != nil {
+		t.Fatalf("Reading flash errored with: %v", err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Errorf("Data read does not match the flash contents")
+	}
+}
+
+func TestReadPartitionList(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	copy(device.Flash[partitionTableOffset:], binary1)
+
+	partitionList, err := e.ReadPartitionList()
+	if err != nil {
+		t.Fatalf("ReadPartitionList errored with: %v", err)
+	}
+	assertPartitionList(t, desired1, partitionList)
+}
+
+func TestVerifyFlash(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	data := []byte("fluepdot firmware")
+	copy(device.Flash[0x10000:], data)
+
+	if err := e.VerifyFlash(0x10000, data); err != nil {
+		t.Errorf("VerifyFlash errored with: %v", err)
+	}
+
+	device.Flash[0x10003] ^= 0x10
+	if err := e.VerifyFlash(0x10000, data); err == nil {
+		t.Errorf("Expected VerifyFlash to detect corrupted flash contents")
+	}
+}
+
+func TestCheckFlashRegions(t *testing.T) {
+	regions := []FlashRegion{
+		{Name: "app", Offset: 0x10000, Data: make([]byte, 0x1000)},
+		{Name: "bootloader", Offset: 0x1000, Data: make([]byte, 0x6000)},
+		{Name: "partitions", Offset: 0x8000, Data: make([]byte, 0xC00)},
+	}
+	if err := CheckFlashRegions(regions); err != nil {
+		t.Errorf("CheckFlashRegions errored with: %v", err)
+	}
+
+	regions[2].Offset = 0x6800
+	if err := CheckFlashRegions(regions); err == nil {
+		t.Errorf("Expected CheckFlashRegions to detect overlapping regions")
+	}
+
+	regions[1].Data = make([]byte, 0x6200)
+	regions[2].Offset = 0x7400
+	if err := CheckFlashRegions(regions); err == nil {
+		t.Errorf("Expected CheckFlashRegions to detect regions sharing a sector")
+	}
+}
+
+func TestWriteFlashRegions(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	regions := []FlashRegion{
+		{Name: "bootloader", Offset: 0x1000, Data: bytes.Repeat([]byte{0x11}, 0x5000)},
+		{Name: "partitions", Offset: 0x8000, Data: binary1},
+		{Name: "app", Offset: 0x10000, Data: bytes.Repeat([]byte{0x22}, 0x3456)},
+	}
+	if err := e.WriteFlashRegions(regions, true, true, true); err != nil {
+		t.Fatalf("WriteFlashRegions errored with: %v", err)
+	}
+	for _, region := range regions {
+		if !bytes.Equal(device.Flash[region.Offset:region.end()], region.Data) {
+			t.Errorf("Region %s was not written", region.String())
+		}
+	}
+}
+
+func TestWriteFlashROMStaysInLoader(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	data := make([]byte, 0x2345)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	for _, offset := range []uint32{0x10000, 0x20000} {
+		// verification runs after the last block, FLASH_END would have made the ROM leave
+		if err := e.WriteFlash(offset, data, false, true, false); err != nil {
+			t.Fatalf("WriteFlash to %X errored with: %v", offset, err)
+		}
+		if !bytes.Equal(device.Flash[offset:int(offset)+len(data)], data) {
+			t.Errorf("Emulated flash at %X does not contain the written data", offset)
+		}
+	}
+	if _, err := e.ReadRegister(chipDetectMagicReg); err != nil {
+		t.Errorf("Expected the ROM to stay in download mode: %v", err)
+	}
+}
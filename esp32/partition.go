@@ -249,7 +249,7 @@ type Partition struct {
 	Name    string           `json:"name"`
 	Type    PartitionType    `json:"type"`
 	SubType PartitionSubType `json:"subtype"`
-	Offset  int              `json:"offset'`
+	Offset  int              `json:"offset"`
 	Size    int              `json:"size"`
 	//Flags   PartitionFlags   `json:"flags"`
 }
@@ -260,6 +260,36 @@ func (p *Partition) String() string {
 
 type PartitionList []Partition
 
+// FindByName returns the partition with the given name or an error if there is none
+func (p PartitionList) FindByName(name string) (*Partition, error) {
+	for index := range p {
+		if p[index].Name == name {
+			return &p[index], nil
+		}
+	}
+	return nil, fmt.Errorf("No partition named '%s' in partition table", name)
+}
+
+// FindByOffset returns the partition starting at offset or nil if there is none
+func (p PartitionList) FindByOffset(offset int) *Partition {
+	for index := range p {
+		if p[index].Offset == offset {
+			return &p[index]
+		}
+	}
+	return nil
+}
+
+// CheckFlashSize returns an error if a partition extends beyond a flash of the given size
+func (p PartitionList) CheckFlashSize(flashSize int) error {
+	for _, partition := range p {
+		if partition.Offset+partition.Size > flashSize {
+			return fmt.Errorf("Partition '%s' ends at %X, beyond the end of the %dKB flash", partition.Name, partition.Offset+partition.Size, flashSize/1024)
+		}
+	}
+	return nil
+}
+
 func (p PartitionList) String() string {
 	builder := &strings.Builder{}
 	for _, partition := range p {
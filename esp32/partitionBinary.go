@@ -13,41 +13,52 @@ var partitionMagicBytes = []byte{0xAA, 0x50}
 var partitionMD5Begin = []byte{0xEB, 0xEB, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
 var partitionTableMaxSize = 0xC00
 
+const partitionEntrySize = 32
+
 type PartitionBinaryReader struct {
 	reader io.Reader
 	md5    hash.Hash
 }
 
 func NewPartitionBinaryReader(reader io.Reader) *PartitionBinaryReader {
-	md5 := md5.New()
 	return &PartitionBinaryReader{
-		reader: io.TeeReader(reader, md5),
-		md5:    md5,
+		reader: reader,
+		md5:    md5.New(),
 	}
 }
 
+// ReadAll reads partition entries up to the end of the table. If the table
+// contains an MD5 entry, it has to match the digest of the preceding entries.
 func (p *PartitionBinaryReader) ReadAll() (partitionList PartitionList, err error) {
 	for {
-		partitionHeader := make([]byte, 2)
-		_, err = p.reader.Read(partitionHeader)
+		entry := make([]byte, partitionEntrySize)
+		_, err = io.ReadFull(p.reader, entry)
+		if err == io.EOF {
+			err = nil
+			return
+		}
 		if err != nil {
 			return
 		}
-		if bytes.Equal(partitionHeader, partitionMD5Begin[:2]) {
-			// TODO check md5sum
+		if bytes.Equal(entry, bytes.Repeat([]byte{0xFF}, partitionEntrySize)) {
 			return
 		}
-		if !bytes.Equal(partitionHeader, partitionMagicBytes) {
-			err = fmt.Errorf("Illegal start of partition header: %v", partitionHeader)
+		if bytes.Equal(entry[:len(partitionMD5Begin)], partitionMD5Begin) {
+			digest := p.md5.Sum(nil)
+			if !bytes.Equal(entry[len(partitionMD5Begin):], digest) {
+				err = fmt.Errorf("Partition table MD5 mismatch: expected %x, calculated %x", entry[len(partitionMD5Begin):], digest)
+			}
 			return
 		}
+		if !bytes.Equal(entry[:2], partitionMagicBytes) {
+			err = fmt.Errorf("Illegal start of partition header: %v", entry[:2])
+			return
+		}
+		p.md5.Write(entry)
 
 		var partition *Partition
-		partition, err = p.Read()
+		partition, err = NewPartitionBinaryReader(bytes.NewReader(entry[2:])).Read()
 		if err != nil {
-			if err == io.EOF {
-				err = nil
-			}
 			return
 		}
 		partitionList = append(partitionList, *partition)
@@ -149,7 +160,6 @@ func (p *PartitionBinaryWriter) WriteAll(partitionList PartitionList) error {
 			return err
 		}
 	}
-	return nil
 }
 
 func (p *Partition) writeBinary(w io.Writer) error {
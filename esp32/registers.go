@@ -0,0 +1,118 @@
+package esp32
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	uart0RegBase       uint = 0x3ff40000
+	gpioRegBase        uint = 0x3ff44000
+	rtcCntlRegBase     uint = 0x3ff48000
+	dportRegBase       uint = 0x3ff00000
+	chipDetectMagicReg uint = 0x40001000
+)
+
+// registerBlocks are peripheral base addresses, registers inside can be given as BLOCK+offset
+var registerBlocks = map[string]uint{
+	"DPORT":    dportRegBase,
+	"UART0":    uart0RegBase,
+	"SPI1":     spiRegBase,
+	"GPIO":     gpioRegBase,
+	"RTC_CNTL": rtcCntlRegBase,
+	"APB_CTRL": drRegSysconBase,
+	"EFUSE":    efuseRegBase,
+}
+
+// registerNames are well known registers, named as in the ESP-IDF headers
+var registerNames = map[string]uint{
+	"CHIP_DETECT_MAGIC_REG": chipDetectMagicReg,
+	"APB_CTRL_DATE_REG":     drRegSysconBase + 0x7C,
+	"GPIO_OUT_REG":          gpioRegBase + 0x04,
+	"GPIO_OUT_W1TS_REG":     gpioRegBase + 0x08,
+	"GPIO_OUT_W1TC_REG":     gpioRegBase + 0x0C,
+	"GPIO_OUT1_REG":         gpioRegBase + 0x10,
+	"GPIO_OUT1_W1TS_REG":    gpioRegBase + 0x14,
+	"GPIO_OUT1_W1TC_REG":    gpioRegBase + 0x18,
+	"GPIO_ENABLE_REG":       gpioRegBase + 0x20,
+	"GPIO_ENABLE_W1TS_REG":  gpioRegBase + 0x24,
+	"GPIO_ENABLE_W1TC_REG":  gpioRegBase + 0x28,
+	"GPIO_ENABLE1_REG":      gpioRegBase + 0x2C,
+	"GPIO_IN_REG":           gpioRegBase + 0x3C,
+	"GPIO_IN1_REG":          gpioRegBase + 0x40,
+	"SPI1_CMD_REG":          spiCmdReg,
+	"SPI1_USR_REG":          spiUsrReg,
+	"SPI1_USR2_REG":         spiUsr2Reg,
+	"SPI1_MOSI_DLEN_REG":    spiMosiDlenReg,
+	"SPI1_MISO_DLEN_REG":    spiMisoDlenReg,
+	"SPI1_W0_REG":           spiW0Reg,
+}
+
+func init() {
+	for index := uint(0); index < 7; index++ {
+		registerNames[fmt.Sprintf("EFUSE_BLK0_RDATA%d_REG", index)] = efuseRegBase + 4*index
+		registerNames[fmt.Sprintf("EFUSE_BLK0_WDATA%d_REG", index)] = efuseRegBase + 0x1C + 4*index
+	}
+}
+
+// knowsRegisterName returns true if name resolves to the same register on chip. The names
+// are those of the ESP32, only the chip detect magic register is at the same address on all chips.
+func knowsRegisterName(chip Chip, name string) bool {
+	return chip.Name() == ChipNameESP32 || name == "CHIP_DETECT_MAGIC_REG"
+}
+
+// ParseRegister parses a register address of chip given as number (e.g. 0x3ff44004), as name of a
+// well known register (e.g. GPIO_OUT_REG) or as peripheral block and offset (e.g. GPIO+0x4)
+func ParseRegister(chip Chip, value string) (uint, error) {
+	value = strings.TrimSpace(value)
+	if address, found := registerNames[strings.ToUpper(value)]; found {
+		if !knowsRegisterName(chip, strings.ToUpper(value)) {
+			return 0, fmt.Errorf("%s is an ESP32 register, give the address of the register on the %s", value, chip.Name())
+		}
+		return address, nil
+	}
+	if parts := strings.SplitN(value, "+", 2); len(parts) == 2 {
+		if chip.Name() != ChipNameESP32 {
+			return 0, fmt.Errorf("%s is in an ESP32 register block, give the address of the register on the %s", value, chip.Name())
+		}
+		base, found := registerBlocks[strings.ToUpper(parts[0])]
+		if !found {
+			return 0, fmt.Errorf("Unknown register block '%s'", parts[0])
+		}
+		offset, err := strconv.ParseUint(parts[1], 0, 32)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid register offset '%s': %v", parts[1], err)
+		}
+		return base + uint(offset), nil
+	}
+	address, err := strconv.ParseUint(value, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown register '%s', expected a well known register name or an address", value)
+	}
+	return uint(address), nil
+}
+
+// RegisterName returns the name of a well known register of chip, or its address in hex
+func RegisterName(chip Chip, address uint) string {
+	for name, registerAddress := range registerNames {
+		if registerAddress == address && knowsRegisterName(chip, name) {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%08X", address)
+}
+
+// RegisterNames lists the names of all well known ESP32 registers and register blocks
+func RegisterNames() []string {
+	names := make([]string, 0, len(registerNames)+len(registerBlocks))
+	for name := range registerNames {
+		names = append(names, name)
+	}
+	for name := range registerBlocks {
+		names = append(names, name+"+offset")
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,66 @@
+package esp32
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRegister(t *testing.T) {
+	testCases := []struct {
+		value   string
+		address uint
+	}{
+		{"0x3ff44004", 0x3ff44004},
+		{"GPIO_OUT_REG", 0x3ff44004},
+		{"gpio_in_reg", 0x3ff4403C},
+		{"EFUSE_BLK0_RDATA3_REG", 0x6001a00C},
+		{"EFUSE+0x10", 0x6001a010},
+		{"apb_ctrl+124", 0x3ff6607C},
+	}
+	for _, testCase := range testCases {
+		address, err := ParseRegister(chips[ChipNameESP32], testCase.value)
+		if err != nil {
+			t.Errorf("Parsing '%s' errored with: %v", testCase.value, err)
+		} else if address != testCase.address {
+			t.Errorf("Expected '%s' to be %08X, got %08X", testCase.value, testCase.address, address)
+		}
+	}
+
+	for _, value := range []string{"GPIO_FOO_REG", "FOO+0x4", "GPIO+bar", "0x100000000"} {
+		if _, err := ParseRegister(chips[ChipNameESP32], value); err == nil {
+			t.Errorf("Expected an error for '%s'", value)
+		}
+	}
+
+	s3 := chips[ChipNameESP32S3]
+	for _, value := range []string{"SPI1_W0_REG", "GPIO+0x4"} {
+		if _, err := ParseRegister(s3, value); err == nil || !strings.Contains(err.Error(), "ESP32-S3") {
+			t.Errorf("Expected ESP32 register '%s' to be rejected on the ESP32-S3, got: %v", value, err)
+		}
+	}
+	if address, err := ParseRegister(s3, "chip_detect_magic_reg"); err != nil || address != chipDetectMagicReg {
+		t.Errorf("Expected the chip detect magic register on the ESP32-S3, got %08X: %v", address, err)
+	}
+	if address, err := ParseRegister(s3, "0x60004004"); err != nil || address != 0x60004004 {
+		t.Errorf("Expected addresses to be accepted on the ESP32-S3, got %08X: %v", address, err)
+	}
+	if name := RegisterName(s3, 0x3ff44004); name != "0x3FF44004" {
+		t.Errorf("Expected no ESP32 register name on the ESP32-S3, got %s", name)
+	}
+}
+
+func TestWriteRegister(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	device.Registers[0x3ff44004] = 0xFF00
+
+	if err := e.WriteRegister(0x3ff44004, 0x0F0F, 0x00FF, 0); err != nil {
+		t.Fatalf("WriteRegister errored with: %v", err)
+	}
+	value, err := e.readRegisterUint32(0x3ff44004)
+	if err != nil {
+		t.Fatalf("ReadRegister errored with: %v", err)
+	}
+	if value != 0xFF0F {
+		t.Errorf("Expected masked write to result in FF0F, got %08X", value)
+	}
+}
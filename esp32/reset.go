@@ -0,0 +1,198 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/common"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ResetStrategyAuto tries the classic sequence and falls back to the USB-Serial/JTAG one
+	ResetStrategyAuto = "auto"
+	// ResetStrategyClassic drives EN and IO0 through the usual two transistor auto-reset circuit
+	ResetStrategyClassic = "classic"
+	// ResetStrategyClassicLong is the classic sequence with longer delays for slow reset circuits
+	ResetStrategyClassicLong = "classic-long"
+	// ResetStrategyUSBJTAGSerial resets through the USB-Serial/JTAG controller, which derives
+	// EN and IO0 from the line states itself
+	ResetStrategyUSBJTAGSerial = "usb-jtag-serial"
+	// ResetStrategyHard only pulses EN, the chip boots according to its strapping pins
+	ResetStrategyHard = "hard"
+	// ResetStrategyNone leaves the lines alone, the chip is expected to wait in download mode
+	ResetStrategyNone = "none"
+)
+
+// resetStrategies are the sequences of the named reset strategies
+var resetStrategies = map[string]string{
+	ResetStrategyClassic:       "D0|R1|W0.1|D1|R0|W0.005",
+	ResetStrategyClassicLong:   "D0|R1|W0.5|D1|R0|W0.5|D0",
+	ResetStrategyUSBJTAGSerial: "D0|R0|W0.1|D1|R0|W0.1|R1|D0|W0.1|D0|R0",
+	ResetStrategyHard:          "D0|R1|W0.1|R0",
+	ResetStrategyNone:          "",
+}
+
+// resetStep sets DTR or RTS, or waits if line is 'W'
+type resetStep struct {
+	line  byte
+	value bool
+	delay time.Duration
+}
+
+// ResetSequence is a list of steps driving DTR (wired to IO0) and RTS (wired to EN)
+type ResetSequence []resetStep
+
+// ParseResetSequence parses steps separated by '|': D0 and D1 set DTR, R0 and R1 set RTS
+// and W followed by seconds waits, e.g. D0|R1|W0.1|D1|R0
+func ParseResetSequence(value string) (ResetSequence, error) {
+	sequence := ResetSequence{}
+	if value == "" {
+		return sequence, nil
+	}
+	for _, token := range strings.Split(value, "|") {
+		token = strings.TrimSpace(token)
+		if len(token) < 2 {
+			return nil, fmt.Errorf("Invalid reset step '%s', expected D0, D1, R0, R1 or W<seconds>", token)
+		}
+		step := resetStep{line: strings.ToUpper(token)[0]}
+		switch step.line {
+		case 'D', 'R':
+			if token[1:] != "0" && token[1:] != "1" {
+				return nil, fmt.Errorf("Invalid reset step '%s', lines can only be set to 0 or 1", token)
+			}
+			step.value = token[1:] == "1"
+		case 'W':
+			seconds, err := strconv.ParseFloat(token[1:], 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("Invalid reset step '%s', expected a wait time in seconds", token)
+			}
+			step.delay = time.Duration(seconds * float64(time.Second))
+		default:
+			return nil, fmt.Errorf("Invalid reset step '%s', expected D0, D1, R0, R1 or W<seconds>", token)
+		}
+		sequence = append(sequence, step)
+	}
+	return sequence, nil
+}
+
+// ParseResetStrategy returns the sequence of a named strategy like classic or parses a custom
+// sequence, see ParseResetSequence. The auto strategy results in a nil sequence.
+func ParseResetStrategy(value string) (ResetSequence, error) {
+	if strings.ToLower(value) == ResetStrategyAuto {
+		return nil, nil
+	}
+	if sequence, found := resetStrategies[strings.ToLower(value)]; found {
+		return ParseResetSequence(sequence)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("Empty reset strategy")
+	}
+	sequence, err := ParseResetSequence(value)
+	if err != nil {
+		return nil, fmt.Errorf("%v (or use one of auto, %s)", err, strings.Join(ResetStrategyNames(), ", "))
+	}
+	return sequence, nil
+}
+
+// ResetStrategyNames lists the named reset strategies besides auto
+func ResetStrategyNames() []string {
+	return []string{
+		ResetStrategyClassic,
+		ResetStrategyClassicLong,
+		ResetStrategyUSBJTAGSerial,
+		ResetStrategyHard,
+		ResetStrategyNone,
+	}
+}
+
+// Run executes the sequence on the modem control lines of transport
+func (s ResetSequence) Run(transport common.Transport) (err error) {
+	for _, step := range s {
+		switch step.line {
+		case 'D':
+			err = transport.SetDTR(step.value)
+		case 'R':
+			err = transport.SetRTS(step.value)
+		case 'W':
+			time.Sleep(step.delay)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s ResetSequence) String() string {
+	tokens := make([]string, 0, len(s))
+	for _, step := range s {
+		switch step.line {
+		case 'W':
+			tokens = append(tokens, "W"+strconv.FormatFloat(step.delay.Seconds(), 'f', -1, 64))
+		default:
+			value := "0"
+			if step.value {
+				value = "1"
+			}
+			tokens = append(tokens, string(step.line)+value)
+		}
+	}
+	return strings.Join(tokens, "|")
+}
+
+// HardReset pulses EN with IO0 released, so the chip leaves the loader and boots the application
+func (e *ESP32ROM) HardReset() error {
+	e.logger.Print("Hard resetting")
+	sequence, err := ParseResetStrategy(ResetStrategyHard)
+	if err != nil {
+		return err
+	}
+	err = sequence.Run(e.Transport)
+	e.leftLoader()
+	return err
+}
+
+// SoftReset leaves the loader and runs the application without touching EN. The ROM does so on
+// any FLASH_END, of the flasher stubs only the one of the ESP8266 supports it.
+func (e *ESP32ROM) SoftReset() error {
+	e.logger.Print("Soft resetting")
+	if e.stubLoaded {
+		if e.chip.Name() != ChipNameESP8266 {
+			return fmt.Errorf("The %s flasher stub can't run the application, use a hard reset", e.chip.Name())
+		}
+		// the stub jumps into the application right away, there is no response
+		err := e.SlipReadWriter.Write(common.NewCommand(common.OpcodeRunUserCode, nil).ToBytes())
+		e.leftLoader()
+		return err
+	}
+
+	if !e.flashAttached {
+		if err := e.AttachSpiFlash(); err != nil {
+			return err
+		}
+	}
+	_, err := e.CheckExecuteCommand(
+		e.newBeginFlashCommand(false, 0, 0, e.chip.FlashWriteSize(false), 0),
+		e.defaultTimeout,
+		e.defaultRetries,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = e.CheckExecuteCommand(
+		// a reboot would sample GPIO0 again, which may still be held low
+		common.NewFlashEndCommand(false),
+		e.defaultTimeout,
+		e.defaultRetries,
+	)
+	e.leftLoader()
+	return err
+}
+
+// leftLoader forgets the state of the loader, which is no longer running
+func (e *ESP32ROM) leftLoader() {
+	e.flashAttached = false
+	e.stubLoaded = false
+	e.statusLength = common.StatusLengthUnknown
+}
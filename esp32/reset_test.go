@@ -0,0 +1,90 @@
+package esp32
+
+import (
+	"fmt"
+	"github.com/fluepke/esptool/emulator"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+// noModemLinesDevice is an emulated device behind a transport without DTR and RTS, like a pty
+type noModemLinesDevice struct {
+	*emulator.Device
+}
+
+func (d *noModemLinesDevice) SetDTR(dtr bool) error {
+	return fmt.Errorf("inappropriate ioctl for device")
+}
+
+func (d *noModemLinesDevice) SetRTS(rts bool) error {
+	return fmt.Errorf("inappropriate ioctl for device")
+}
+
+func TestParseResetStrategy(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		sequence string
+		err      string
+	}{
+		{"D0|R1|W0.1|D1|R0", "D0|R1|W0.1|D1|R0", ""},
+		{"d0 | r1 | w2", "D0|R1|W2", ""},
+		{"classic", "D0|R1|W0.1|D1|R0|W0.005", ""},
+		{"none", "", ""},
+		{"D0|X1", "", "Invalid reset step 'X1'"},
+		{"R2", "", "lines can only be set to 0 or 1"},
+		{"W-1", "", "expected a wait time in seconds"},
+		{"", "", "Empty reset strategy"},
+	} {
+		sequence, err := ParseResetStrategy(test.value)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected '%s' to fail with '%s', got: %v", test.value, test.err, err)
+			}
+			continue
+		}
+		if err != nil || sequence == nil || sequence.String() != test.sequence {
+			t.Errorf("Expected '%s' to be parsed as %s, got %s: %v", test.value, test.sequence, sequence.String(), err)
+		}
+	}
+	if sequence, err := ParseResetStrategy("auto"); sequence != nil || err != nil {
+		t.Errorf("Expected a nil sequence for auto, got %s: %v", sequence.String(), err)
+	}
+}
+
+func TestConnectWithoutReset(t *testing.T) {
+	device := &noModemLinesDevice{emulator.NewDevice(4*1024*1024, nil)}
+	e := NewESP32ROM(device, log.New(ioutil.Discard, "", 0))
+	if err := e.Connect(1); err == nil {
+		t.Errorf("Expected the automatic reset to fail without modem control lines")
+	}
+
+	e.ResetSequence, _ = ParseResetStrategy(ResetStrategyNone)
+	if err := e.Connect(1); err != nil {
+		t.Fatalf("Connect without reset errored with: %v", err)
+	}
+	if e.Chip().Name() != ChipNameESP32 {
+		t.Errorf("Expected an ESP32, detected %s", e.Chip().Name())
+	}
+}
+
+func TestResetAfter(t *testing.T) {
+	e, _ := newEmulatedESP32ROM(t)
+	for _, leave := range []func() error{e.HardReset, e.SoftReset} {
+		if err := leave(); err != nil {
+			t.Fatalf("Leaving the loader errored with: %v", err)
+		}
+		if _, err := e.ReadRegister(chipDetectMagicReg); err == nil {
+			t.Errorf("Expected the loader to be gone")
+		}
+		if err := e.Connect(1); err != nil {
+			t.Fatalf("Connect errored with: %v", err)
+		}
+	}
+
+	e.ResetSequence, _ = ParseResetSequence("D0|R1|W0.01|D1|R0")
+	if err := e.Connect(1); err != nil {
+		t.Errorf("Connect with a custom reset sequence errored with: %v", err)
+	}
+}
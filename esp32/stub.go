@@ -0,0 +1,119 @@
+package esp32
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/fluepke/esptool/common"
+	"io"
+	"time"
+)
+
+const blockLengthRAM uint32 = 0x1800
+
+var stubGreeting = []byte("OHAI")
+
+// Stub is a RAM flasher stub in the JSON format shipped with esptool.py (stub_flasher_32.json).
+// The text and data segments are base64 encoded in the JSON file.
+type Stub struct {
+	Text      []byte `json:"text"`
+	TextStart uint32 `json:"text_start"`
+	Data      []byte `json:"data"`
+	DataStart uint32 `json:"data_start"`
+	Entry     uint32 `json:"entry"`
+}
+
+// LoadStub reads a flasher stub in the esptool.py JSON format
+func LoadStub(reader io.Reader) (*Stub, error) {
+	stub := &Stub{}
+	if err := json.NewDecoder(reader).Decode(stub); err != nil {
+		return nil, fmt.Errorf("Could not parse stub: %v", err)
+	}
+	if stub.Entry == 0 || len(stub.Text) == 0 {
+		return nil, fmt.Errorf("Stub has no text segment or entry point")
+	}
+	return stub, nil
+}
+
+// IsStub returns true if the flasher stub is running on the chip
+func (e *ESP32ROM) IsStub() bool {
+	return e.stubLoaded
+}
+
+// RunStub uploads the flasher stub to RAM, jumps to its entry point and waits for its greeting.
+// Afterwards all commands are handled by the stub.
+func (e *ESP32ROM) RunStub(stub *Stub) (err error) {
+	if e.stubLoaded {
+		return nil
+	}
+	e.logger.Print("Uploading flasher stub")
+
+	for _, segment := range []struct {
+		data   []byte
+		offset uint32
+	}{
+		{stub.Text, stub.TextStart},
+		{stub.Data, stub.DataStart},
+	} {
+		if len(segment.data) == 0 {
+			continue
+		}
+		if err = e.WriteMemory(segment.offset, segment.data); err != nil {
+			return fmt.Errorf("Could not upload stub segment at %08X: %v", segment.offset, err)
+		}
+	}
+
+	_, err = e.CheckExecuteCommand(
+		common.NewMemEndCommand(stub.Entry),
+		e.defaultTimeout,
+		e.defaultRetries,
+	)
+	if err != nil {
+		return err
+	}
+
+	greeting, err := e.SlipReadWriter.Read(1000 * time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("Stub did not start: %v", err)
+	}
+	if !bytes.Equal(greeting, stubGreeting) {
+		return fmt.Errorf("Unexpected greeting from stub: %X", greeting)
+	}
+
+	e.stubLoaded = true
+	e.statusLength = common.StatusLengthStub
+	e.flashAttached = false
+	e.logger.Print("Stub running")
+	return nil
+}
+
+// WriteMemory uploads data to RAM at the given address without executing it
+func (e *ESP32ROM) WriteMemory(offset uint32, data []byte) (err error) {
+	blockLength := e.chip.RAMBlockSize()
+	numBlocks := (uint32(len(data)) + blockLength - 1) / blockLength
+	_, err = e.CheckExecuteCommand(
+		common.NewMemBeginCommand(uint32(len(data)), numBlocks, blockLength, offset),
+		e.defaultTimeout,
+		e.defaultRetries,
+	)
+	if err != nil {
+		return err
+	}
+
+	for sequence := uint32(0); sequence < numBlocks; sequence++ {
+		start := sequence * blockLength
+		end := start + blockLength
+		if end > uint32(len(data)) {
+			end = uint32(len(data))
+		}
+		_, err = e.CheckExecuteCommand(
+			common.NewMemDataCommand(data[start:end], sequence),
+			e.defaultTimeout,
+			e.defaultRetries,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
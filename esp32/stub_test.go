@@ -0,0 +1,84 @@
+package esp32
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+var stubJSON = `{
+  "text": "3q2+796tvu/erb7v3q2+796tvu8=",
+  "text_start": 1074520064,
+  "data": "AAECAwQFBgc=",
+  "data_start": 1073605544,
+  "entry": 1074520068
+}`
+
+func TestRunStub(t *testing.T) {
+	stub, err := LoadStub(strings.NewReader(stubJSON))
+	if err != nil {
+		t.Fatalf("LoadStub errored with: %v", err)
+	}
+	if len(stub.Text) != 20 || stub.Entry != 0x400BE004 {
+		t.Errorf("Stub was not decoded properly: %d bytes of text, entry %08X", len(stub.Text), stub.Entry)
+	}
+
+	e, device := newEmulatedESP32ROM(t)
+	if err = e.RunStub(stub); err != nil {
+		t.Fatalf("RunStub errored with: %v", err)
+	}
+	if !e.IsStub() || !device.IsStub() {
+		t.Fatalf("Stub is not running")
+	}
+
+	data := make([]byte, 3*blockLengthWriteMaxStub+100)
+	rand.New(rand.NewSource(2)).Read(data)
+	for _, useCompression := range []bool{false, true} {
+		if err = e.WriteFlash(0x20000, data, useCompression, true, false); err != nil {
+			t.Fatalf("WriteFlash through stub errored with: %v", err)
+		}
+		if !bytes.Equal(device.Flash[0x20000:0x20000+len(data)], data) {
+			t.Errorf("Emulated flash does not contain the written data")
+		}
+	}
+}
+
+func TestChangeBaudrateStub(t *testing.T) {
+	stub, _ := LoadStub(strings.NewReader(stubJSON))
+	e, device := newEmulatedESP32ROM(t)
+	if err := e.RunStub(stub); err != nil {
+		t.Fatalf("RunStub errored with: %v", err)
+	}
+	// the stub is told the connect baudrate as the current one
+	if err := e.ChangeBaudrate(921600); err != nil {
+		t.Fatalf("ChangeBaudrate errored with: %v", err)
+	}
+	if device.Baudrate != 921600 {
+		t.Errorf("Expected device baudrate 921600, received %d", device.Baudrate)
+	}
+	if err := e.ChangeBaudrate(460800); err != nil || device.Baudrate != 460800 {
+		t.Errorf("Expected a second change to 460800, got %d: %v", device.Baudrate, err)
+	}
+}
+
+func TestReadFlashStub(t *testing.T) {
+	stub, err := LoadStub(strings.NewReader(stubJSON))
+	if err != nil {
+		t.Fatalf("LoadStub errored with: %v", err)
+	}
+	e, device := newEmulatedESP32ROM(t)
+	if err = e.RunStub(stub); err != nil {
+		t.Fatalf("RunStub errored with: %v", err)
+	}
+
+	rand.New(rand.NewSource(3)).Read(device.Flash)
+	size := uint32(readFlashMaxInFlight+3)*readFlashSectorSize + 17
+	buf := &bytes.Buffer{}
+	if err = e.ReadFlashTo(0x1000, size, buf); err != nil {
+		t.Fatalf("ReadFlashTo errored with: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), device.Flash[0x1000:0x1000+size]) {
+		t.Errorf("Data read through stub does not match flash contents")
+	}
+}
@@ -0,0 +1,140 @@
+package esp32
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fluepke/esptool/image"
+)
+
+// maxChipRevisionUnset marks images that can run on any future chip revision
+const maxChipRevisionUnset uint16 = 0xFFFF
+
+// ValidationError is returned by ValidateFlashRegions if a region is rejected, as opposed to
+// errors talking to the chip
+type ValidationError struct {
+	err error
+}
+
+func (v *ValidationError) Error() string {
+	return v.err.Error()
+}
+
+func (v *ValidationError) Unwrap() error {
+	return v.err
+}
+
+// rejectRegion returns a ValidationError
+func rejectRegion(format string, args ...interface{}) error {
+	return &ValidationError{err: fmt.Errorf(format, args...)}
+}
+
+// ValidateFlashRegions checks regions targeting well known locations before anything is written.
+// The bootloader and app partitions have to contain valid images built for the connected chip,
+// the partition table has to be a valid binary partition table that fits the detected flash.
+// App partitions are looked up in the partition table written along with the regions, or else
+// in the one on the chip.
+func (e *ESP32ROM) ValidateFlashRegions(regions []FlashRegion) error {
+	partitionTableOffset := e.chip.PartitionTableOffset()
+	bootloaderOffset := e.chip.BootloaderOffset()
+	var partitionList PartitionList
+	// without a partition table there are no app partitions to validate
+	partitionListKnown := partitionTableOffset == 0
+	for _, region := range regions {
+		if partitionTableOffset == 0 || region.Offset != partitionTableOffset {
+			continue
+		}
+		list, err := validatePartitionTable(region.Data)
+		if err != nil {
+			return rejectRegion("Region %s is not a valid partition table: %v", region.String(), err)
+		}
+		flashSize, err := e.DetectFlashSize()
+		if err != nil {
+			e.logger.Printf("Partition table is not checked against the flash size: %v", err)
+		} else if err = list.CheckFlashSize(flashSize); err != nil {
+			return rejectRegion("Region %s does not fit the flash: %v", region.String(), err)
+		}
+		partitionList, partitionListKnown = list, true
+	}
+
+	var description *ChipDescription
+	for _, region := range regions {
+		kind := "bootloader"
+		if partitionTableOffset != 0 && region.Offset == partitionTableOffset {
+			continue
+		}
+		if region.Offset != bootloaderOffset {
+			if !partitionListKnown {
+				list, err := e.ReadPartitionList()
+				if err != nil {
+					e.logger.Printf("No valid partition table on chip, app partitions are not validated: %v", err)
+				}
+				partitionList, partitionListKnown = list, true
+			}
+			partition := partitionList.FindByOffset(int(region.Offset))
+			if partition == nil || partition.Type != PartitionTypeApp {
+				continue
+			}
+			kind = fmt.Sprintf("app image for partition '%s'", partition.Name)
+			if len(region.Data) > partition.Size {
+				return rejectRegion("Region %s does not fit into partition '%s' of size %d", region.String(), partition.Name, partition.Size)
+			}
+		}
+
+		img, err := e.chip.ReadImage(bytes.NewReader(region.Data))
+		if err == nil {
+			err = img.Verify()
+		}
+		if err != nil {
+			return rejectRegion("Region %s is not a valid %s: %v", region.String(), kind, err)
+		}
+		if description == nil {
+			description, err = e.GetChipDescription()
+			if err != nil {
+				return fmt.Errorf("Could not retrieve chip description: %v", err)
+			}
+		}
+		if err = description.CheckImage(img); err != nil {
+			return rejectRegion("Region %s is not a valid %s: %v", region.String(), kind, err)
+		}
+	}
+	return nil
+}
+
+// validatePartitionTable parses a binary partition table, requiring at least one entry and a valid MD5
+func validatePartitionTable(data []byte) (PartitionList, error) {
+	if len(data) > partitionTableMaxSize {
+		return nil, fmt.Errorf("Partition table is larger than %d bytes", partitionTableMaxSize)
+	}
+	if !bytes.Contains(data, partitionMD5Begin) {
+		return nil, fmt.Errorf("Partition table has no MD5 entry")
+	}
+	partitionList, err := NewPartitionBinaryReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(partitionList) == 0 {
+		return nil, fmt.Errorf("Partition table is empty")
+	}
+	return partitionList, nil
+}
+
+// CheckImage returns an error if img can't run on the chip
+func (c *ChipDescription) CheckImage(img *image.Image) error {
+	if img.ChipID != c.Chip.ImageChipID() {
+		return fmt.Errorf("Image is built for %s, but the chip is an %s", img.ChipID.String(), c.Chip.Name())
+	}
+	revision := c.FullRevision()
+	// older images only have the major revision in MinRevision
+	minRevision := img.MinChipRevisionFull
+	if legacyMinRevision := uint16(img.MinRevision) * 100; legacyMinRevision > minRevision {
+		minRevision = legacyMinRevision
+	}
+	if minRevision > revision {
+		return fmt.Errorf("Image requires chip revision v%d.%d, but the chip is revision v%d.%d", minRevision/100, minRevision%100, c.Revision, c.MinorRevision)
+	}
+	// images built before maximum revisions were introduced have zero here
+	if img.MaxChipRevisionFull != 0 && img.MaxChipRevisionFull != maxChipRevisionUnset && revision > img.MaxChipRevisionFull {
+		return fmt.Errorf("Image supports chip revisions up to v%d.%d, but the chip is revision v%d.%d", img.MaxChipRevisionFull/100, img.MaxChipRevisionFull%100, c.Revision, c.MinorRevision)
+	}
+	return nil
+}
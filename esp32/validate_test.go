@@ -0,0 +1,89 @@
+package esp32
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/fluepke/esptool/image"
+	"testing"
+)
+
+// buildTestImage returns an image with a single segment and an appended SHA-256
+func buildTestImage(chipID image.ChipID, minRevisionFull uint16) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{image.Magic, 1, byte(image.SpiModeDIO), byte(image.FlashSize4MB)})
+	binary.Write(buf, binary.LittleEndian, uint32(0x40080000))
+	extended := make([]byte, 16)
+	binary.LittleEndian.PutUint16(extended[4:6], uint16(chipID))
+	binary.LittleEndian.PutUint16(extended[7:9], minRevisionFull)
+	extended[15] = 1
+	buf.Write(extended)
+
+	data := bytes.Repeat([]byte{0x12, 0x34}, 64)
+	binary.Write(buf, binary.LittleEndian, uint32(0x3FFB0000))
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	buf.Write(make([]byte, 15-buf.Len()%16))
+	buf.WriteByte(0xEF) // data XORs to zero
+	digest := sha256.Sum256(buf.Bytes())
+	buf.Write(digest[:])
+	return buf.Bytes()
+}
+
+func TestValidateFlashRegions(t *testing.T) {
+	e, _ := newEmulatedESP32ROM(t)
+	validImage := buildTestImage(image.ChipIDESP32, 100)
+	corruptedPartitionTable := append([]byte{}, binary1...)
+	corruptedPartitionTable[2] = 0x00
+
+	testCases := []struct {
+		name    string
+		regions []FlashRegion
+		valid   bool
+	}{
+		{"bootloader", []FlashRegion{{Offset: 0x1000, Data: validImage}}, true},
+		{"random bootloader", []FlashRegion{{Offset: 0x1000, Data: bytes.Repeat([]byte{0x11}, 0x100)}}, false},
+		{"wrong chip", []FlashRegion{{Offset: 0x1000, Data: buildTestImage(image.ChipIDESP32S2, 0)}}, false},
+		{"chip revision too old", []FlashRegion{{Offset: 0x1000, Data: buildTestImage(image.ChipIDESP32, 300)}}, false},
+		{"partition table", []FlashRegion{{Offset: 0x8000, Data: binary1}}, true},
+		{"corrupted partition table", []FlashRegion{{Offset: 0x8000, Data: corruptedPartitionTable}}, false},
+		{"app", []FlashRegion{{Offset: 0x8000, Data: binary1}, {Offset: 0x10000, Data: validImage}}, true},
+		{"random app", []FlashRegion{{Offset: 0x8000, Data: binary1}, {Offset: 0x10000, Data: bytes.Repeat([]byte{0x22}, 0x100)}}, false},
+		{"no partition table", []FlashRegion{{Offset: 0x10000, Data: bytes.Repeat([]byte{0x22}, 0x100)}}, true},
+	}
+	for _, testCase := range testCases {
+		err := e.ValidateFlashRegions(testCase.regions)
+		if testCase.valid && err != nil {
+			t.Errorf("%s: expected regions to be valid, got: %v", testCase.name, err)
+		}
+		var validationError *ValidationError
+		if !testCase.valid && !errors.As(err, &validationError) {
+			t.Errorf("%s: expected validation to fail with a ValidationError, got: %v", testCase.name, err)
+		}
+	}
+}
+
+func TestWriteFlashValidatesAppPartition(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	copy(device.Flash[partitionTableOffset:], binary1)
+
+	if err := e.WriteFlash(0x10000, bytes.Repeat([]byte{0x22}, 0x100), true, true, false); err == nil {
+		t.Errorf("Expected WriteFlash to refuse writing garbage to the factory partition")
+	}
+	if device.Flash[0x10000] != 0xFF {
+		t.Errorf("Flash was modified although validation failed")
+	}
+	if err := e.WriteFlash(0x10000, bytes.Repeat([]byte{0x22}, 0x100), true, true, true); err != nil {
+		t.Errorf("Forced WriteFlash errored with: %v", err)
+	}
+}
+
+func TestValidatePartitionTableFlashSize(t *testing.T) {
+	e, device := newEmulatedESP32ROM(t)
+	device.FlashID = 0x144020 // 1MB, too small for the factory partition ending at 0x110000
+
+	if err := e.ValidateFlashRegions([]FlashRegion{{Offset: 0x8000, Data: binary1}}); err == nil {
+		t.Errorf("Expected validation to fail for a partition table exceeding the flash")
+	}
+}
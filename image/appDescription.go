@@ -0,0 +1,46 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+const (
+	appDescriptionMagic  uint32 = 0xABCD5432
+	appDescriptionLength        = 256
+)
+
+// AppDescription is the esp_app_desc_t placed at the start of the first segment of ESP-IDF applications
+type AppDescription struct {
+	SecureVersion uint32
+	Version       string
+	ProjectName   string
+	Time          string
+	Date          string
+	IdfVersion    string
+	ElfSHA256     string
+}
+
+// parseAppDescription returns nil if data does not start with an esp_app_desc_t
+func parseAppDescription(data []byte) *AppDescription {
+	if len(data) < appDescriptionLength || binary.LittleEndian.Uint32(data[0:4]) != appDescriptionMagic {
+		return nil
+	}
+	return &AppDescription{
+		SecureVersion: binary.LittleEndian.Uint32(data[4:8]),
+		Version:       cString(data[16:48]),
+		ProjectName:   cString(data[48:80]),
+		Time:          cString(data[80:96]),
+		Date:          cString(data[96:112]),
+		IdfVersion:    cString(data[112:144]),
+		ElfSHA256:     hex.EncodeToString(data[144:176]),
+	}
+}
+
+func cString(data []byte) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return string(data)
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// MagicESP8266V2 is the first byte of ESP8266 images with an irom segment in front
+	MagicESP8266V2 byte = 0xEA
+
+	esp8266V2SegmentCount = 4
+)
+
+// esp8266FlashSizeToBytes holds the flash sizes in the header of ESP8266 images, whose
+// encoding differs from the ESP32 family. The -c1 variants use another flash map layout.
+var esp8266FlashSizeToBytes = map[FlashSize]int{
+	0x00: 512 * 1024,
+	0x10: 256 * 1024,
+	0x20: 1 * 1024 * 1024,
+	0x30: 2 * 1024 * 1024,
+	0x40: 4 * 1024 * 1024,
+	0x50: 2 * 1024 * 1024,
+	0x60: 4 * 1024 * 1024,
+	0x80: 8 * 1024 * 1024,
+	0x90: 16 * 1024 * 1024,
+}
+
+// ReadESP8266 parses an ESP8266 image from reader, either a V1 image or a V2 image
+// with irom segment and appended CRC32, see Read
+func ReadESP8266(reader io.Reader) (*Image, error) {
+	return readImage(reader, true)
+}
+
+// ParseESP8266 parses an ESP8266 image from a byte slice, see ReadESP8266
+func ParseESP8266(data []byte) (*Image, error) {
+	return ReadESP8266(bytes.NewReader(data))
+}
+
+// ParseAny parses an image of any supported chip. ESP8266 V2 images are recognized by their
+// magic, V1 images by not parsing as an ESP32 image with a valid checksum.
+func ParseAny(data []byte) (*Image, error) {
+	if len(data) > 0 && data[0] == MagicESP8266V2 {
+		return ParseESP8266(data)
+	}
+	image, err := Parse(data)
+	if err == nil && image.ChecksumValid {
+		return image, nil
+	}
+	if esp8266, esp8266Err := ParseESP8266(data); esp8266Err == nil && esp8266.ChecksumValid {
+		return esp8266, nil
+	}
+	return image, err
+}
+
+// FlashSizeBytes returns the flash size in the header in bytes, decoded the way the chip
+// the image was built for does, or 0 if it is unknown
+func (i *Image) FlashSizeBytes() int {
+	if i.ChipID != ChipIDESP8266 {
+		return i.FlashSize.Bytes()
+	}
+	return esp8266FlashSizeToBytes[i.FlashSize]
+}
+
+// FlashSizeName returns the flash size in the header, see FlashSizeBytes
+func (i *Image) FlashSizeName() string {
+	if i.ChipID != ChipIDESP8266 {
+		return i.FlashSize.String()
+	}
+	size := i.FlashSizeBytes()
+	if size == 0 {
+		return fmt.Sprintf("unknown (%02X)", byte(i.FlashSize))
+	}
+	name := strconv.Itoa(size/1024) + "KB"
+	if size >= 1024*1024 {
+		name = strconv.Itoa(size/1024/1024) + "MB"
+	}
+	if i.FlashSize == 0x50 || i.FlashSize == 0x60 {
+		name += "-c1"
+	}
+	return name
+}
+
+// esp8266CRC turns the CRC32 of a V2 image into the value the ESP8266 bootloader expects
+func esp8266CRC(crc uint32) uint32 {
+	if crc&0x80000000 != 0 {
+		return crc ^ 0xFFFFFFFF
+	}
+	return crc + 1
+}
@@ -0,0 +1,85 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// buildESP8266Image assembles an image the way esptool.py elf2image does for the ESP8266,
+// a V2 image if irom is given
+func buildESP8266Image(segments []testSegment, irom *testSegment) []byte {
+	buf := &bytes.Buffer{}
+	if irom != nil {
+		buf.Write([]byte{MagicESP8266V2, esp8266V2SegmentCount, byte(SpiModeQIO), 0x40})
+		binary.Write(buf, binary.LittleEndian, uint32(0x40100004))
+		binary.Write(buf, binary.LittleEndian, irom.loadAddress)
+		binary.Write(buf, binary.LittleEndian, uint32(len(irom.data)))
+		buf.Write(irom.data)
+	}
+	buf.Write([]byte{Magic, byte(len(segments)), byte(SpiModeQIO), 0x40})
+	binary.Write(buf, binary.LittleEndian, uint32(0x40100004))
+	checksum := byte(checksumInitial)
+	for _, segment := range segments {
+		binary.Write(buf, binary.LittleEndian, segment.loadAddress)
+		binary.Write(buf, binary.LittleEndian, uint32(len(segment.data)))
+		buf.Write(segment.data)
+		for _, b := range segment.data {
+			checksum ^= b
+		}
+	}
+	buf.Write(make([]byte, checksumAlignment-1-buf.Len()%checksumAlignment))
+	buf.WriteByte(checksum)
+	if irom != nil {
+		binary.Write(buf, binary.LittleEndian, esp8266CRC(crc32.ChecksumIEEE(buf.Bytes())))
+	}
+	return buf.Bytes()
+}
+
+func TestParseESP8266(t *testing.T) {
+	segments := []testSegment{
+		{0x40100000, bytes.Repeat([]byte{0x12, 0x34}, 50)},
+		{0x3FFE8000, []byte{0xAA, 0xBB, 0xCC}},
+	}
+	irom := &testSegment{0, bytes.Repeat([]byte{0x55}, 40)}
+
+	for _, test := range []struct {
+		name string
+		irom *testSegment
+	}{
+		{"V1", nil},
+		{"V2", irom},
+	} {
+		data := buildESP8266Image(segments, test.irom)
+		img, err := ParseAny(append(data, 0xFF, 0xFF))
+		if err != nil {
+			t.Fatalf("%s: ParseAny failed: %v", test.name, err)
+		}
+		if img.ChipID != ChipIDESP8266 || len(img.Segments) != 2 || img.Length != len(data) {
+			t.Errorf("%s: unexpected image %+v", test.name, img)
+		}
+		if err = img.Verify(); err != nil {
+			t.Errorf("%s: verification failed: %v", test.name, err)
+		}
+		if img.FlashSizeName() != "4MB" {
+			t.Errorf("%s: expected a 4MB flash, got %s", test.name, img.FlashSizeName())
+		}
+		if test.irom != nil && (img.IROMSegment == nil || len(img.IROMSegment.Data) != len(irom.data) || !img.CRCValid) {
+			t.Errorf("%s: unexpected irom segment %v or CRC %08X", test.name, img.IROMSegment, img.CRC)
+		}
+		if !bytes.Equal(img.Bytes(), data) {
+			t.Errorf("%s: serialized image does not match the parsed one", test.name)
+		}
+	}
+
+	data := buildESP8266Image(segments, irom)
+	data[len(data)-1] ^= 0x01
+	img, err := ParseESP8266(data)
+	if err != nil {
+		t.Fatalf("ParseESP8266 failed: %v", err)
+	}
+	if err = img.Verify(); err == nil {
+		t.Errorf("Expected a corrupted CRC to fail verification")
+	}
+}
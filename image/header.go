@@ -0,0 +1,205 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SpiMode is the SPI flash access mode stored in byte 2 of the image header
+type SpiMode byte
+
+const (
+	SpiModeQIO  SpiMode = 0x00
+	SpiModeQOUT SpiMode = 0x01
+	SpiModeDIO  SpiMode = 0x02
+	SpiModeDOUT SpiMode = 0x03
+)
+
+var spiModeToString = map[SpiMode]string{
+	SpiModeQIO:  "qio",
+	SpiModeQOUT: "qout",
+	SpiModeDIO:  "dio",
+	SpiModeDOUT: "dout",
+}
+
+func (s SpiMode) String() string {
+	name, found := spiModeToString[s]
+	if found {
+		return name
+	}
+	return fmt.Sprintf("unknown (%02X)", byte(s))
+}
+
+func (s SpiMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ParseSpiMode parses names like "dio" into a SpiMode
+func ParseSpiMode(value string) (SpiMode, error) {
+	for spiMode, name := range spiModeToString {
+		if name == strings.ToLower(value) {
+			return spiMode, nil
+		}
+	}
+	return 0, fmt.Errorf("Illegal SPI flash mode '%s'", value)
+}
+
+// FlashFrequency is the SPI clock stored in the lower nibble of byte 3 of the image header
+type FlashFrequency byte
+
+const (
+	FlashFrequency40M FlashFrequency = 0x0
+	FlashFrequency26M FlashFrequency = 0x1
+	FlashFrequency20M FlashFrequency = 0x2
+	FlashFrequency80M FlashFrequency = 0xF
+)
+
+var flashFrequencyToString = map[FlashFrequency]string{
+	FlashFrequency40M: "40m",
+	FlashFrequency26M: "26m",
+	FlashFrequency20M: "20m",
+	FlashFrequency80M: "80m",
+}
+
+func (f FlashFrequency) String() string {
+	name, found := flashFrequencyToString[f]
+	if found {
+		return name
+	}
+	return fmt.Sprintf("unknown (%X)", byte(f))
+}
+
+func (f FlashFrequency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// ParseFlashFrequency parses names like "40m" into a FlashFrequency
+func ParseFlashFrequency(value string) (FlashFrequency, error) {
+	for flashFrequency, name := range flashFrequencyToString {
+		if name == strings.ToLower(value) {
+			return flashFrequency, nil
+		}
+	}
+	return 0, fmt.Errorf("Illegal SPI flash frequency '%s'", value)
+}
+
+// FlashSize is the flash chip size stored in the upper nibble of byte 3 of the image header
+type FlashSize byte
+
+const (
+	FlashSize1MB   FlashSize = 0x00
+	FlashSize2MB   FlashSize = 0x10
+	FlashSize4MB   FlashSize = 0x20
+	FlashSize8MB   FlashSize = 0x30
+	FlashSize16MB  FlashSize = 0x40
+	FlashSize32MB  FlashSize = 0x50
+	FlashSize64MB  FlashSize = 0x60
+	FlashSize128MB FlashSize = 0x70
+)
+
+var flashSizeToBytes = map[FlashSize]int{
+	FlashSize1MB:   1 * 1024 * 1024,
+	FlashSize2MB:   2 * 1024 * 1024,
+	FlashSize4MB:   4 * 1024 * 1024,
+	FlashSize8MB:   8 * 1024 * 1024,
+	FlashSize16MB:  16 * 1024 * 1024,
+	FlashSize32MB:  32 * 1024 * 1024,
+	FlashSize64MB:  64 * 1024 * 1024,
+	FlashSize128MB: 128 * 1024 * 1024,
+}
+
+// Bytes returns the flash size in bytes or 0 if it is unknown
+func (f FlashSize) Bytes() int {
+	return flashSizeToBytes[f]
+}
+
+func (f FlashSize) String() string {
+	size, found := flashSizeToBytes[f]
+	if found {
+		return strconv.Itoa(size/1024/1024) + "MB"
+	}
+	return fmt.Sprintf("unknown (%02X)", byte(f))
+}
+
+func (f FlashSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// FlashSizeFromBytes returns the FlashSize for a flash chip with the given number of bytes
+func FlashSizeFromBytes(size int) (FlashSize, error) {
+	for flashSize, bytes := range flashSizeToBytes {
+		if bytes == size {
+			return flashSize, nil
+		}
+	}
+	return 0, fmt.Errorf("Unsupported flash size %d", size)
+}
+
+// ParseFlashSize parses names like "4MB" into a FlashSize
+func ParseFlashSize(value string) (FlashSize, error) {
+	for flashSize := range flashSizeToBytes {
+		if flashSize.String() == strings.ToUpper(value) {
+			return flashSize, nil
+		}
+	}
+	return 0, fmt.Errorf("Illegal flash size '%s'", value)
+}
+
+// ChipID identifies the chip an image was built for, see esp_chip_id_t
+type ChipID uint16
+
+const (
+	ChipIDESP32   ChipID = 0x0000
+	ChipIDESP32S2 ChipID = 0x0002
+	ChipIDESP32C3 ChipID = 0x0005
+	ChipIDESP32S3 ChipID = 0x0009
+	ChipIDESP32C2 ChipID = 0x000C
+	ChipIDESP32C6 ChipID = 0x000D
+	ChipIDESP32H2 ChipID = 0x0010
+	// ChipIDESP8266 is not stored in images, it marks ESP8266 images, which have no extended header
+	ChipIDESP8266 ChipID = 0xFFFF
+)
+
+func (c ChipID) String() string {
+	name, found := map[ChipID]string{
+		ChipIDESP32:   "ESP32",
+		ChipIDESP32S2: "ESP32-S2",
+		ChipIDESP32C3: "ESP32-C3",
+		ChipIDESP32S3: "ESP32-S3",
+		ChipIDESP32C2: "ESP32-C2",
+		ChipIDESP32C6: "ESP32-C6",
+		ChipIDESP32H2: "ESP32-H2",
+		ChipIDESP8266: "ESP8266",
+	}[c]
+	if found {
+		return name
+	}
+	return fmt.Sprintf("unknown (%04X)", uint16(c))
+}
+
+func (c ChipID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// Header is the common header of all ESP images
+type Header struct {
+	Magic          byte
+	SegmentCount   byte
+	SpiMode        SpiMode
+	FlashSize      FlashSize
+	FlashFrequency FlashFrequency
+	EntryPoint     uint32
+}
+
+// ExtendedHeader follows the Header in images for the ESP32 family, see esp_image_header_t
+type ExtendedHeader struct {
+	WpPin               byte
+	SpiPinDrv           [3]byte
+	ChipID              ChipID
+	MinRevision         byte
+	MinChipRevisionFull uint16
+	MaxChipRevisionFull uint16
+	HashAppended        bool
+}
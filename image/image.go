@@ -0,0 +1,277 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// Magic is the first byte of every ESP image
+	Magic byte = 0xE9
+
+	headerLength         = 8
+	extendedHeaderLength = 16
+	segmentHeaderLength  = 8
+	checksumAlignment    = 16
+	checksumInitial      = 0xEF
+	hashLength           = sha256.Size
+	maxSegmentCount      = 16
+	maxSegmentLength     = 16 * 1024 * 1024
+)
+
+// Segment is a chunk of the image that the bootloader loads or maps to LoadAddress
+type Segment struct {
+	LoadAddress uint32
+	Data        []byte `json:"-"`
+}
+
+func (s *Segment) String() string {
+	return fmt.Sprintf("%08X (%d bytes)", s.LoadAddress, len(s.Data))
+}
+
+// Image is an application or bootloader image. ESP8266 images have no extended header,
+// their ChipID is set to ChipIDESP8266.
+type Image struct {
+	Header
+	ExtendedHeader
+	// IROMSegment is the flash mapped code in front of ESP8266 V2 images, it is not covered by the checksum
+	IROMSegment *Segment `json:",omitempty"`
+	Segments    []Segment
+	// Checksum is the XOR checksum stored in the image
+	Checksum      byte
+	ChecksumValid bool
+	// Hash is the appended SHA-256 digest, if any
+	Hash      []byte
+	HashValid bool
+	// CRC is the CRC32 appended to ESP8266 V2 images
+	CRC      uint32 `json:",omitempty"`
+	CRCValid bool   `json:",omitempty"`
+	// Length is the total length of the image in bytes, including checksum and hash
+	Length         int
+	AppDescription *AppDescription
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.reader.Read(p)
+	c.count += n
+	return
+}
+
+// Read parses an image from reader, consuming exactly the bytes belonging to the image.
+// An invalid checksum or hash does not cause an error, see ChecksumValid, HashValid and Verify.
+func Read(reader io.Reader) (*Image, error) {
+	return readImage(reader, false)
+}
+
+func readImage(reader io.Reader, esp8266 bool) (*Image, error) {
+	hash := sha256.New()
+	crc := crc32.NewIEEE()
+	counter := &countingReader{reader: reader}
+	hashedReader := io.TeeReader(counter, io.MultiWriter(hash, crc))
+	image := &Image{}
+
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(hashedReader, header); err != nil {
+		return nil, fmt.Errorf("Could not read image header: %v", err)
+	}
+	v2 := esp8266 && header[0] == MagicESP8266V2
+	if v2 {
+		// the irom segment comes first, followed by a regular header
+		irom, err := readSegment(hashedReader)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read irom segment: %v", err)
+		}
+		image.IROMSegment = irom
+		if _, err := io.ReadFull(hashedReader, header); err != nil {
+			return nil, fmt.Errorf("Could not read second image header: %v", err)
+		}
+	}
+	if err := image.parseHeader(header); err != nil {
+		return nil, err
+	}
+	if v2 {
+		image.Magic = MagicESP8266V2
+	}
+	if esp8266 {
+		image.ChipID = ChipIDESP8266
+	} else {
+		extended := make([]byte, extendedHeaderLength)
+		if _, err := io.ReadFull(hashedReader, extended); err != nil {
+			return nil, fmt.Errorf("Could not read extended image header: %v", err)
+		}
+		image.parseExtendedHeader(extended)
+	}
+
+	for index := 0; index < int(image.SegmentCount); index++ {
+		segment, err := readSegment(hashedReader)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read segment %d: %v", index, err)
+		}
+		image.Segments = append(image.Segments, *segment)
+	}
+
+	// the checksum is the last byte of a 16 byte aligned block
+	padding := make([]byte, checksumAlignment-counter.count%checksumAlignment)
+	if _, err := io.ReadFull(hashedReader, padding); err != nil {
+		return nil, fmt.Errorf("Could not read checksum: %v", err)
+	}
+	image.Checksum = padding[len(padding)-1]
+	image.ChecksumValid = image.Checksum == image.calculateChecksum()
+
+	if image.HashAppended {
+		image.Hash = make([]byte, hashLength)
+		calculatedHash := hash.Sum(nil)
+		if _, err := io.ReadFull(counter, image.Hash); err != nil {
+			return nil, fmt.Errorf("Could not read appended SHA-256: %v", err)
+		}
+		image.HashValid = bytes.Equal(image.Hash, calculatedHash)
+	}
+	if v2 {
+		calculatedCRC := esp8266CRC(crc.Sum32())
+		if err := binary.Read(counter, binary.LittleEndian, &image.CRC); err != nil {
+			return nil, fmt.Errorf("Could not read appended CRC32: %v", err)
+		}
+		image.CRCValid = image.CRC == calculatedCRC
+	}
+	image.Length = counter.count
+
+	if len(image.Segments) > 0 && !esp8266 {
+		image.AppDescription = parseAppDescription(image.Segments[0].Data)
+	}
+
+	return image, nil
+}
+
+func readSegment(reader io.Reader) (*Segment, error) {
+	segmentHeader := make([]byte, segmentHeaderLength)
+	if _, err := io.ReadFull(reader, segmentHeader); err != nil {
+		return nil, err
+	}
+	segment := &Segment{
+		LoadAddress: binary.LittleEndian.Uint32(segmentHeader[0:4]),
+	}
+	length := binary.LittleEndian.Uint32(segmentHeader[4:8])
+	if length > maxSegmentLength {
+		return nil, fmt.Errorf("Invalid length %d", length)
+	}
+	segment.Data = make([]byte, length)
+	if _, err := io.ReadFull(reader, segment.Data); err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+// Parse parses an image from a byte slice, see Read
+func Parse(data []byte) (*Image, error) {
+	return Read(bytes.NewReader(data))
+}
+
+func (i *Image) parseHeader(header []byte) error {
+	i.Magic = header[0]
+	if i.Magic != Magic {
+		return fmt.Errorf("Invalid image magic %02X, expected %02X", i.Magic, Magic)
+	}
+	i.SegmentCount = header[1]
+	if i.SegmentCount == 0 || i.SegmentCount > maxSegmentCount {
+		return fmt.Errorf("Invalid segment count %d", i.SegmentCount)
+	}
+	i.SpiMode = SpiMode(header[2])
+	i.FlashSize = FlashSize(header[3] & 0xF0)
+	i.FlashFrequency = FlashFrequency(header[3] & 0x0F)
+	i.EntryPoint = binary.LittleEndian.Uint32(header[4:8])
+	return nil
+}
+
+func (i *Image) parseExtendedHeader(extended []byte) {
+	i.WpPin = extended[0]
+	copy(i.SpiPinDrv[:], extended[1:4])
+	i.ChipID = ChipID(binary.LittleEndian.Uint16(extended[4:6]))
+	i.MinRevision = extended[6]
+	i.MinChipRevisionFull = binary.LittleEndian.Uint16(extended[7:9])
+	i.MaxChipRevisionFull = binary.LittleEndian.Uint16(extended[9:11])
+	i.HashAppended = extended[15] == 1
+}
+
+func (i *Image) calculateChecksum() byte {
+	checksum := byte(checksumInitial)
+	for _, segment := range i.Segments {
+		for _, b := range segment.Data {
+			checksum ^= b
+		}
+	}
+	return checksum
+}
+
+// Bytes serializes the image. The checksum and, if HashAppended is set, the SHA-256
+// are calculated from the current contents, so header fields may be changed before.
+func (i *Image) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	magic := i.Magic
+	if magic == MagicESP8266V2 {
+		buf.Write([]byte{MagicESP8266V2, esp8266V2SegmentCount, byte(i.SpiMode), byte(i.FlashSize) | byte(i.FlashFrequency)})
+		binary.Write(buf, binary.LittleEndian, i.EntryPoint)
+		writeSegment(buf, i.IROMSegment)
+		magic = Magic
+	}
+	buf.Write([]byte{magic, byte(len(i.Segments)), byte(i.SpiMode), byte(i.FlashSize) | byte(i.FlashFrequency)})
+	binary.Write(buf, binary.LittleEndian, i.EntryPoint)
+
+	if i.ChipID != ChipIDESP8266 {
+		extended := make([]byte, extendedHeaderLength)
+		extended[0] = i.WpPin
+		copy(extended[1:4], i.SpiPinDrv[:])
+		binary.LittleEndian.PutUint16(extended[4:6], uint16(i.ChipID))
+		extended[6] = i.MinRevision
+		binary.LittleEndian.PutUint16(extended[7:9], i.MinChipRevisionFull)
+		binary.LittleEndian.PutUint16(extended[9:11], i.MaxChipRevisionFull)
+		if i.HashAppended {
+			extended[15] = 1
+		}
+		buf.Write(extended)
+	}
+
+	for index := range i.Segments {
+		writeSegment(buf, &i.Segments[index])
+	}
+	buf.Write(make([]byte, checksumAlignment-1-buf.Len()%checksumAlignment))
+	buf.WriteByte(i.calculateChecksum())
+
+	if i.HashAppended {
+		hash := sha256.Sum256(buf.Bytes())
+		buf.Write(hash[:])
+	}
+	if i.Magic == MagicESP8266V2 {
+		binary.Write(buf, binary.LittleEndian, esp8266CRC(crc32.ChecksumIEEE(buf.Bytes())))
+	}
+	return buf.Bytes()
+}
+
+func writeSegment(buf *bytes.Buffer, segment *Segment) {
+	binary.Write(buf, binary.LittleEndian, segment.LoadAddress)
+	binary.Write(buf, binary.LittleEndian, uint32(len(segment.Data)))
+	buf.Write(segment.Data)
+}
+
+// Verify returns an error if the checksum or the appended SHA-256 do not match the image contents
+func (i *Image) Verify() error {
+	if !i.ChecksumValid {
+		return fmt.Errorf("Image checksum %02X does not match contents", i.Checksum)
+	}
+	if i.HashAppended && !i.HashValid {
+		return fmt.Errorf("Appended SHA-256 %x does not match contents", i.Hash)
+	}
+	if i.Magic == MagicESP8266V2 && !i.CRCValid {
+		return fmt.Errorf("Appended CRC32 %08X does not match contents", i.CRC)
+	}
+	return nil
+}
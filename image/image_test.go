@@ -0,0 +1,157 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+type testSegment struct {
+	loadAddress uint32
+	data        []byte
+}
+
+// buildImage assembles an image the way esptool.py elf2image does
+func buildImage(segments []testSegment, hashAppended bool) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{Magic, byte(len(segments)), byte(SpiModeDIO), byte(FlashSize4MB) | byte(FlashFrequency40M)})
+	binary.Write(buf, binary.LittleEndian, uint32(0x40080000))
+	extended := make([]byte, extendedHeaderLength)
+	extended[0] = 0xEE
+	binary.LittleEndian.PutUint16(extended[4:6], uint16(ChipIDESP32))
+	extended[6] = 1
+	binary.LittleEndian.PutUint16(extended[7:9], 100)
+	binary.LittleEndian.PutUint16(extended[9:11], 399)
+	if hashAppended {
+		extended[15] = 1
+	}
+	buf.Write(extended)
+
+	checksum := byte(checksumInitial)
+	for _, segment := range segments {
+		binary.Write(buf, binary.LittleEndian, segment.loadAddress)
+		binary.Write(buf, binary.LittleEndian, uint32(len(segment.data)))
+		buf.Write(segment.data)
+		for _, b := range segment.data {
+			checksum ^= b
+		}
+	}
+	buf.Write(make([]byte, checksumAlignment-1-buf.Len()%checksumAlignment))
+	buf.WriteByte(checksum)
+	if hashAppended {
+		digest := sha256.Sum256(buf.Bytes())
+		buf.Write(digest[:])
+	}
+	return buf.Bytes()
+}
+
+func TestParseImage(t *testing.T) {
+	segments := []testSegment{
+		{0x3F400020, bytes.Repeat([]byte{0x12, 0x34, 0x56}, 100)},
+		{0x40080000, []byte{0xAA, 0xBB, 0xCC, 0xDD}},
+	}
+	data := buildImage(segments, true)
+	// trailing data must not be consumed
+	img, err := Parse(append(data, 0xFF, 0xFF))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if img.SpiMode != SpiModeDIO || img.FlashSize != FlashSize4MB || img.FlashFrequency != FlashFrequency40M {
+		t.Errorf("Unexpected flash settings %v, %v, %v", img.SpiMode, img.FlashSize, img.FlashFrequency)
+	}
+	if img.EntryPoint != 0x40080000 {
+		t.Errorf("Expected entry point 40080000, got %08X", img.EntryPoint)
+	}
+	if img.WpPin != 0xEE || img.ChipID != ChipIDESP32 || img.MinRevision != 1 || img.MinChipRevisionFull != 100 || img.MaxChipRevisionFull != 399 {
+		t.Errorf("Unexpected extended header %+v", img.ExtendedHeader)
+	}
+	if len(img.Segments) != len(segments) {
+		t.Fatalf("Expected %d segments, got %d", len(segments), len(img.Segments))
+	}
+	for index, segment := range segments {
+		if img.Segments[index].LoadAddress != segment.loadAddress || !bytes.Equal(img.Segments[index].Data, segment.data) {
+			t.Errorf("Segment %d does not match: %s", index, img.Segments[index].String())
+		}
+	}
+	if img.Length != len(data) {
+		t.Errorf("Expected length %d, got %d", len(data), img.Length)
+	}
+	if err = img.Verify(); err != nil {
+		t.Errorf("Valid image failed verification: %v", err)
+	}
+	if img.AppDescription != nil {
+		t.Errorf("Expected no app description")
+	}
+}
+
+func TestParseImageCorrupted(t *testing.T) {
+	data := buildImage([]testSegment{{0x3FFB0000, []byte{1, 2, 3, 4, 5, 6, 7, 8}}}, true)
+
+	data[headerLength+extendedHeaderLength+segmentHeaderLength] ^= 0x01
+	img, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if img.ChecksumValid || img.HashValid || img.Verify() == nil {
+		t.Errorf("Corrupted image passed verification")
+	}
+
+	data[0] = 0x00
+	if _, err = Parse(data); err == nil {
+		t.Errorf("Expected an error for invalid magic")
+	}
+	if _, err = Parse(data[:10]); err == nil {
+		t.Errorf("Expected an error for truncated image")
+	}
+}
+
+func TestParseAppDescription(t *testing.T) {
+	description := make([]byte, appDescriptionLength)
+	binary.LittleEndian.PutUint32(description[0:4], appDescriptionMagic)
+	binary.LittleEndian.PutUint32(description[4:8], 2)
+	copy(description[16:48], "1.2.3")
+	copy(description[48:80], "hello_world")
+	copy(description[112:144], "v4.4")
+
+	img, err := Parse(buildImage([]testSegment{{0x3F400020, description}}, false))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if img.Hash != nil || img.Verify() != nil {
+		t.Errorf("Expected valid image without hash")
+	}
+	app := img.AppDescription
+	if app == nil {
+		t.Fatalf("Expected an app description")
+	}
+	if app.SecureVersion != 2 || app.Version != "1.2.3" || app.ProjectName != "hello_world" || app.IdfVersion != "v4.4" {
+		t.Errorf("Unexpected app description %+v", app)
+	}
+}
+
+func TestImageBytes(t *testing.T) {
+	data := buildImage([]testSegment{{0x3F400020, []byte{1, 2, 3}}, {0x40080000, []byte{4, 5, 6, 7, 8}}}, true)
+	img, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !bytes.Equal(img.Bytes(), data) {
+		t.Errorf("Serialized image does not match the parsed one")
+	}
+
+	img.SpiMode = SpiModeQIO
+	img.FlashSize = FlashSize8MB
+	img.FlashFrequency = FlashFrequency80M
+	patched, err := Parse(img.Bytes())
+	if err != nil {
+		t.Fatalf("Parsing patched image failed: %v", err)
+	}
+	if patched.SpiMode != SpiModeQIO || patched.FlashSize != FlashSize8MB || patched.FlashFrequency != FlashFrequency80M {
+		t.Errorf("Unexpected flash settings %v, %v, %v", patched.SpiMode, patched.FlashSize, patched.FlashFrequency)
+	}
+	if err = patched.Verify(); err != nil {
+		t.Errorf("Patched image failed verification: %v", err)
+	}
+}
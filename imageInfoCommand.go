@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fluepke/esptool/image"
+	"os"
+	"strings"
+)
+
+type SegmentInfo struct {
+	LoadAddress string
+	Size        int
+}
+
+type ImageInfo struct {
+	Source          string
+	ChipID          string
+	MinChipRevision string
+	MaxChipRevision string
+	FlashMode       string
+	FlashFrequency  string
+	FlashSize       string
+	EntryPoint      string
+	IROMSegment     *SegmentInfo `json:",omitempty"`
+	Segments        []SegmentInfo
+	Checksum        string
+	ChecksumValid   bool
+	SHA256          string `json:",omitempty"`
+	SHA256Valid     bool
+	CRC32           string `json:",omitempty"`
+	CRC32Valid      bool   `json:",omitempty"`
+	Length          int
+	App             *image.AppDescription `json:",omitempty"`
+}
+
+func NewImageInfo(source string, img *image.Image) *ImageInfo {
+	imageInfo := &ImageInfo{
+		Source:          source,
+		ChipID:          img.ChipID.String(),
+		MinChipRevision: chipRevisionString(img.MinChipRevisionFull),
+		MaxChipRevision: chipRevisionString(img.MaxChipRevisionFull),
+		FlashMode:       img.SpiMode.String(),
+		FlashFrequency:  img.FlashFrequency.String(),
+		FlashSize:       img.FlashSizeName(),
+		EntryPoint:      fmt.Sprintf("%08X", img.EntryPoint),
+		Segments:        make([]SegmentInfo, 0, len(img.Segments)),
+		Checksum:        fmt.Sprintf("%02X", img.Checksum),
+		ChecksumValid:   img.ChecksumValid,
+		SHA256:          hex.EncodeToString(img.Hash),
+		SHA256Valid:     img.HashValid,
+		Length:          img.Length,
+		App:             img.AppDescription,
+	}
+	if img.IROMSegment != nil {
+		imageInfo.IROMSegment = &SegmentInfo{
+			LoadAddress: fmt.Sprintf("%08X", img.IROMSegment.LoadAddress),
+			Size:        len(img.IROMSegment.Data),
+		}
+		imageInfo.CRC32 = fmt.Sprintf("%08X", img.CRC)
+		imageInfo.CRC32Valid = img.CRCValid
+	}
+	for _, segment := range img.Segments {
+		imageInfo.Segments = append(imageInfo.Segments, SegmentInfo{
+			LoadAddress: fmt.Sprintf("%08X", segment.LoadAddress),
+			Size:        len(segment.Data),
+		})
+	}
+	return imageInfo
+}
+
+func chipRevisionString(revision uint16) string {
+	return fmt.Sprintf("v%d.%d", revision/100, revision%100)
+}
+
+func validString(valid bool) string {
+	if valid {
+		return "valid"
+	}
+	return "** invalid **"
+}
+
+func (i *ImageInfo) String() string {
+	builder := &strings.Builder{}
+	fmt.Fprint(builder, underline(bold(("Image Information"))))
+	fmt.Fprint(builder, "\n")
+	fmt.Fprintf(builder, "%s: %s\n", bold("Source"), i.Source)
+	fmt.Fprintf(builder, "%s: %s\n", bold("Chip"), i.ChipID)
+	fmt.Fprintf(builder, "%s: %s - %s\n", bold("Chip Revision"), i.MinChipRevision, i.MaxChipRevision)
+	fmt.Fprintf(builder, "%s: %s, %s, %s\n", bold("Flash"), i.FlashMode, i.FlashFrequency, i.FlashSize)
+	fmt.Fprintf(builder, "%s: %s\n", bold("Entry Point"), i.EntryPoint)
+	fmt.Fprintf(builder, "%s: %d bytes\n", bold("Length"), i.Length)
+	fmt.Fprintf(builder, "%s: %s (%s)\n", bold("Checksum"), i.Checksum, validString(i.ChecksumValid))
+	if i.SHA256 != "" {
+		fmt.Fprintf(builder, "%s: %s (%s)\n", bold("SHA-256"), i.SHA256, validString(i.SHA256Valid))
+	} else {
+		fmt.Fprintf(builder, "%s: none\n", bold("SHA-256"))
+	}
+	if i.CRC32 != "" {
+		fmt.Fprintf(builder, "%s: %s (%s)\n", bold("CRC32"), i.CRC32, validString(i.CRC32Valid))
+	}
+	if i.IROMSegment != nil {
+		fmt.Fprintf(builder, "%s: %s (%d bytes)\n", bold("IROM Segment"), i.IROMSegment.LoadAddress, i.IROMSegment.Size)
+	}
+	fmt.Fprintln(builder, bold("Segments"))
+	for index, segment := range i.Segments {
+		fmt.Fprintf(builder, "  %d: %s (%d bytes)\n", index, segment.LoadAddress, segment.Size)
+	}
+	if i.App != nil {
+		fmt.Fprintln(builder, bold("Application"))
+		fmt.Fprintf(builder, "  %s: %s\n", bold("Project"), i.App.ProjectName)
+		fmt.Fprintf(builder, "  %s: %s\n", bold("Version"), i.App.Version)
+		fmt.Fprintf(builder, "  %s: %s %s\n", bold("Compiled"), i.App.Date, i.App.Time)
+		fmt.Fprintf(builder, "  %s: %s\n", bold("IDF Version"), i.App.IdfVersion)
+		fmt.Fprintf(builder, "  %s: %d\n", bold("Secure Version"), i.App.SecureVersion)
+		fmt.Fprintf(builder, "  %s: %s\n", bold("ELF SHA-256"), i.App.ElfSHA256)
+	}
+	return builder.String()
+}
+
+func imageInfoCommand(jsonOutput bool, imageInfo *ImageInfo) error {
+	if jsonOutput {
+		prettyJson, err := json.MarshalIndent(imageInfo, "", "  ")
+
+		if err != nil {
+			return fmt.Errorf("Could not generate JSON outputs: %s", err.Error())
+		}
+		_, err = os.Stdout.Write(prettyJson)
+		return err
+	}
+
+	_, err := fmt.Println(imageInfo.String())
+
+	return err
+}
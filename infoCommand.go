@@ -4,29 +4,50 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/fluepke/esptool/esp32"
+	"log"
 	"os"
 	"strconv"
 	"strings"
 )
 
+type FlashInfo struct {
+	Manufacturer   string
+	ManufacturerID string
+	DeviceID       string
+	Size           int
+}
+
 type DeviceInfo struct {
-	ChipType   string
-	Revision   string
-	Features   []string
-	MacAddress string
-	Partitions esp32.PartitionList
+	Chip         string
+	ChipType     string
+	Revision     string
+	FullRevision string
+	Features     []string
+	MacAddress   string
+	Flash        *FlashInfo
+	Partitions   esp32.PartitionList `json:",omitempty"`
+	// hasPartitionTable is false for chips with a fixed flash layout
+	hasPartitionTable bool
 }
 
 func (d *DeviceInfo) String() string {
 	builder := &strings.Builder{}
 	fmt.Fprint(builder, underline(bold(("Chip Information"))))
 	fmt.Fprint(builder, "\n")
+	fmt.Fprintf(builder, "%s: %s\n", bold("Chip"), d.Chip)
 	fmt.Fprintf(builder, "%s: %s\n", bold("Chip Type"), d.ChipType)
-	fmt.Fprintf(builder, "%s: %s\n", bold("Revision"), d.Revision)
+	fmt.Fprintf(builder, "%s: %s\n", bold("Revision"), d.FullRevision)
 	fmt.Fprintf(builder, "%s: %s\n", bold("MAC"), d.MacAddress)
 	fmt.Fprintf(builder, "%s: %s\n", bold("Features"), strings.Join(d.Features, ", "))
+	if d.Flash != nil {
+		fmt.Fprintf(builder, "%s: %s (%s), device %s, %dKB\n", bold("Flash"), d.Flash.Manufacturer, d.Flash.ManufacturerID, d.Flash.DeviceID, d.Flash.Size/1024)
+	} else {
+		fmt.Fprintf(builder, "%s: ** unknown **\n", bold("Flash"))
+	}
 	fmt.Fprintln(builder, bold("Partition Table"))
-	if d.Partitions != nil {
+	if !d.hasPartitionTable {
+		fmt.Fprint(builder, "none")
+	} else if d.Partitions != nil {
 		fmt.Fprint(builder, d.Partitions.String())
 	} else {
 		fmt.Fprint(builder, "** invalid **")
@@ -34,7 +55,9 @@ func (d *DeviceInfo) String() string {
 	return builder.String()
 }
 
-func infoCommand(jsonOutput bool, esp32 *esp32.ESP32ROM) error {
+// infoCommand prints the chip information to stdout. Flash and partition table errors go to
+// logger, so stdout holds nothing but the JSON document with jsonOutput.
+func infoCommand(jsonOutput bool, esp32 *esp32.ESP32ROM, logger *log.Logger) error {
 	macAddress, err := esp32.GetChipMAC()
 	if err != nil {
 		return fmt.Errorf("Could not retrieve MAC address: %s", err.Error())
@@ -58,18 +81,36 @@ func infoCommand(jsonOutput bool, esp32 *esp32.ESP32ROM) error {
 	}
 
 	deviceInfo := &DeviceInfo{
-		ChipType:   description.ChipType.String(),
-		Revision:   strconv.Itoa(int(description.Revision)),
-		Features:   featureList,
-		MacAddress: macAddress,
+		Chip:              esp32.Chip().Name(),
+		ChipType:          description.Package,
+		Revision:          strconv.Itoa(int(description.Revision)),
+		FullRevision:      fmt.Sprintf("v%d.%d", description.Revision, description.MinorRevision),
+		Features:          featureList,
+		MacAddress:        macAddress,
+		hasPartitionTable: esp32.Chip().PartitionTableOffset() != 0,
 	}
 
-	partitionList, err := esp32.ReadPartitionList()
+	flashID, err := esp32.GetFlashID()
 	if err != nil {
-		fmt.Printf("Error: %v", err)
+		logger.Printf("Could not read the flash ID: %v", err)
 	}
 	if err == nil {
-		deviceInfo.Partitions = partitionList
+		deviceInfo.Flash = &FlashInfo{
+			Manufacturer:   flashID.ManufacturerName(),
+			ManufacturerID: fmt.Sprintf("%02X", flashID.Manufacturer),
+			DeviceID:       fmt.Sprintf("%04X", flashID.Device),
+			Size:           flashID.Size,
+		}
+	}
+
+	if deviceInfo.hasPartitionTable {
+		partitionList, err := esp32.ReadPartitionList()
+		if err != nil {
+			logger.Printf("Could not read the partition table: %v", err)
+		}
+		if err == nil {
+			deviceInfo.Partitions = partitionList
+		}
 	}
 
 	if jsonOutput {
@@ -3,15 +3,23 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/fluepke/esptool/emulator"
+	"github.com/fluepke/esptool/esp32"
+	"github.com/fluepke/esptool/image"
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const version string = "1.0"
 const defaultConnectBaudrate uint = 115200
 const defaultTransferBaudrate uint = 921600
+const flashSizeMax uint = 16 * 1024 * 1024
+const resetBeforeUsage string = "How to reset into the bootloader: auto, classic, classic-long, usb-jtag-serial, hard, none or a sequence like D0|R1|W0.1|D1|R0"
+const resetAfterUsage string = "What to do when done: hard-reset into the application, soft-reset or no-reset to stay in the loader"
 
 type CliCommand struct {
 	Name        string
@@ -26,35 +34,146 @@ var (
 
 	help = flag.Bool("help", false, "Show a help page")
 
+	portsFlagSet = flag.NewFlagSet("ports", flag.ExitOnError)
+	portsJson    = portsFlagSet.Bool("json", false, "Display ports in JSON format")
+
 	infoFlagSet          = flag.NewFlagSet("info", flag.ExitOnError)
-	infoPort             = infoFlagSet.String("serial.port", "", "Serial port device file")
+	infoPort             = infoFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
 	infoConnectBaudrate  = infoFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
 	infoTransferBaudrate = infoFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
 	infoTimeout          = infoFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
 	infoRetries          = infoFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	infoLockWait         = infoFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	infoResetBefore      = infoFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	infoResetAfter       = infoFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
 	infoJson             = infoFlagSet.Bool("json", false, "Display chip info in JSON format")
 
 	flashReadFlagSet          = flag.NewFlagSet("readFlash", flag.ExitOnError)
-	flashReadPort             = flashReadFlagSet.String("serial.port", "", "Serial port device file")
+	flashReadPort             = flashReadFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
 	flashReadConnectBaudrate  = flashReadFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
 	flashReadTransferBaudrate = flashReadFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
 	flashReadTimeout          = flashReadFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
 	flashReadRetries          = flashReadFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	flashReadLockWait         = flashReadFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	flashReadResetBefore      = flashReadFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	flashReadResetAfter       = flashReadFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
 	flashReadOffset           = flashReadFlagSet.Uint("flash.offset", 0, "Offset")
 	flashReadSize             = flashReadFlagSet.Uint("flash.size", 0, "Bytes to read")
 	flashReadFile             = flashReadFlagSet.String("flash.file", "", "File to read flash contents into")
 	flashReadPartitionName    = flashReadFlagSet.String("flash.partition.name", "", "Partition to read")
+	flashReadStub             = flashReadFlagSet.String("stub.file", "", "Flasher stub in esptool.py JSON format (e.g. stub_flasher_32.json) to upload for fast reads")
 
 	flashWriteFlagSet          = flag.NewFlagSet("writeFlash", flag.ExitOnError)
-	flashWritePort             = flashWriteFlagSet.String("serial.port", "", "Serial port device file")
+	flashWritePort             = flashWriteFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
 	flashWriteConnectBaudrate  = flashWriteFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
 	flashWriteTransferBaudrate = flashWriteFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
 	flashWriteTimeout          = flashWriteFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
 	flashWriteRetries          = flashWriteFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	flashWriteLockWait         = flashWriteFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	flashWriteResetBefore      = flashWriteFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	flashWriteResetAfter       = flashWriteFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
 	flashWriteOffset           = flashWriteFlagSet.Uint("flash.offset", 0, "Offset")
-	flashWriteFile             = flashWriteFlagSet.String("flash.file", "", "File with data to flash")
+	flashWriteFile             = flashWriteFlagSet.String("flash.file", "", "File with data to flash. Further regions can be given as offset=file or partition=file arguments")
 	flashWritePartitionName    = flashWriteFlagSet.String("flash.partition.name", "", "Partition to write")
 	flashWriteCompress         = flashWriteFlagSet.Bool("flash.compress", true, "Use compression for transfer")
+	flashWriteVerify           = flashWriteFlagSet.Bool("flash.verify", true, "Verify written data using the MD5 digest computed on the chip")
+	flashWriteMode             = flashWriteFlagSet.String("flash.mode", esp32.FlashParameterKeep, "SPI flash mode (qio, qout, dio, dout) to set in the bootloader image header or keep")
+	flashWriteFrequency        = flashWriteFlagSet.String("flash.freq", esp32.FlashParameterKeep, "SPI flash frequency (40m, 26m, 20m, 80m) to set in the bootloader image header or keep")
+	flashWriteSize             = flashWriteFlagSet.String("flash.size", esp32.FlashParameterKeep, "Flash size (1MB, 2MB, 4MB, ...) to set in the bootloader image header, detect or keep")
+	flashWriteForce            = flashWriteFlagSet.Bool("flash.force", false, "Skip validation of data written to the bootloader, partition table and app partitions")
+	flashWriteStub             = flashWriteFlagSet.String("stub.file", "", "Flasher stub in esptool.py JSON format (e.g. stub_flasher_32.json) to upload before writing")
+
+	eraseFlashFlagSet          = flag.NewFlagSet("eraseFlash", flag.ExitOnError)
+	eraseFlashPort             = eraseFlashFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	eraseFlashConnectBaudrate  = eraseFlashFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	eraseFlashTransferBaudrate = eraseFlashFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	eraseFlashTimeout          = eraseFlashFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	eraseFlashRetries          = eraseFlashFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	eraseFlashLockWait         = eraseFlashFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	eraseFlashResetBefore      = eraseFlashFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	eraseFlashResetAfter       = eraseFlashFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	eraseFlashStub             = eraseFlashFlagSet.String("stub.file", "", "Flasher stub in esptool.py JSON format (e.g. stub_flasher_32.json) to upload before erasing")
+
+	eraseRegionFlagSet          = flag.NewFlagSet("eraseRegion", flag.ExitOnError)
+	eraseRegionPort             = eraseRegionFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	eraseRegionConnectBaudrate  = eraseRegionFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	eraseRegionTransferBaudrate = eraseRegionFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	eraseRegionTimeout          = eraseRegionFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	eraseRegionRetries          = eraseRegionFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	eraseRegionLockWait         = eraseRegionFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	eraseRegionResetBefore      = eraseRegionFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	eraseRegionResetAfter       = eraseRegionFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	eraseRegionStub             = eraseRegionFlagSet.String("stub.file", "", "Flasher stub in esptool.py JSON format (e.g. stub_flasher_32.json) to upload before erasing")
+	eraseRegionOffset           = eraseRegionFlagSet.Uint("flash.offset", 0, "Offset")
+	eraseRegionSize             = eraseRegionFlagSet.Uint("flash.size", 0, "Bytes to erase")
+	eraseRegionPartitionName    = eraseRegionFlagSet.String("flash.partition.name", "", "Partition to erase")
+
+	imageInfoFlagSet          = flag.NewFlagSet("imageInfo", flag.ExitOnError)
+	imageInfoFile             = imageInfoFlagSet.String("image.file", "", "Image file to inspect. If empty, the image is read from the device")
+	imageInfoPort             = imageInfoFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	imageInfoConnectBaudrate  = imageInfoFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	imageInfoTransferBaudrate = imageInfoFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	imageInfoTimeout          = imageInfoFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	imageInfoRetries          = imageInfoFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	imageInfoLockWait         = imageInfoFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	imageInfoResetBefore      = imageInfoFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	imageInfoResetAfter       = imageInfoFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	imageInfoStub             = imageInfoFlagSet.String("stub.file", "", "Flasher stub in esptool.py JSON format (e.g. stub_flasher_32.json) to upload for fast reads")
+	imageInfoOffset           = imageInfoFlagSet.Uint("flash.offset", 0x10000, "Offset of the image in flash")
+	imageInfoPartitionName    = imageInfoFlagSet.String("flash.partition.name", "", "App partition containing the image")
+	imageInfoJson             = imageInfoFlagSet.Bool("json", false, "Display image info in JSON format")
+
+	regReadFlagSet          = flag.NewFlagSet("regRead", flag.ExitOnError)
+	regReadPort             = regReadFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	regReadConnectBaudrate  = regReadFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	regReadTransferBaudrate = regReadFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	regReadTimeout          = regReadFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	regReadRetries          = regReadFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	regReadLockWait         = regReadFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	regReadResetBefore      = regReadFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	regReadResetAfter       = regReadFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	regReadList             = regReadFlagSet.Bool("register.list", false, "List the names of well known ESP32 registers and exit")
+
+	regWriteFlagSet          = flag.NewFlagSet("regWrite", flag.ExitOnError)
+	regWritePort             = regWriteFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	regWriteConnectBaudrate  = regWriteFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	regWriteTransferBaudrate = regWriteFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	regWriteTimeout          = regWriteFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	regWriteRetries          = regWriteFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	regWriteLockWait         = regWriteFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	regWriteResetBefore      = regWriteFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	regWriteResetAfter       = regWriteFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	regWriteMask             = regWriteFlagSet.Uint("register.mask", 0xFFFFFFFF, "Only bits set in the mask are written")
+	regWriteDelay            = regWriteFlagSet.Duration("register.delay", 0, "Time the chip waits after each write")
+
+	efuseSummaryFlagSet          = flag.NewFlagSet("efuseSummary", flag.ExitOnError)
+	efuseSummaryPort             = efuseSummaryFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	efuseSummaryConnectBaudrate  = efuseSummaryFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	efuseSummaryTransferBaudrate = efuseSummaryFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	efuseSummaryTimeout          = efuseSummaryFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	efuseSummaryRetries          = efuseSummaryFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	efuseSummaryLockWait         = efuseSummaryFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	efuseSummaryResetBefore      = efuseSummaryFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	efuseSummaryResetAfter       = efuseSummaryFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	efuseSummaryJson             = efuseSummaryFlagSet.Bool("json", false, "Display eFuses in JSON format")
+	efuseSummaryVirtual          = efuseSummaryFlagSet.String("efuse.virtual", "", "Use a virtual ESP32 with eFuses stored in this file instead of a serial port")
+
+	efuseBurnFlagSet          = flag.NewFlagSet("efuseBurn", flag.ExitOnError)
+	efuseBurnPort             = efuseBurnFlagSet.String("serial.port", "", "Serial port device file, probes all USB serial ports if empty")
+	efuseBurnConnectBaudrate  = efuseBurnFlagSet.Uint("serial.baudrate.connect", defaultConnectBaudrate, "Serial signalling rate during connect phase")
+	efuseBurnTransferBaudrate = efuseBurnFlagSet.Uint("serial.baudrate.transfer", defaultTransferBaudrate, "Serial signalling rate during data transfer")
+	efuseBurnTimeout          = efuseBurnFlagSet.Duration("serial.connect.timeout", 500*time.Millisecond, "Timeout to wait for chip response upon connecting")
+	efuseBurnRetries          = efuseBurnFlagSet.Uint("serial.connect.retries", 5, "How often to retry connecting")
+	efuseBurnLockWait         = efuseBurnFlagSet.Duration("serial.lock.wait", 0, "How long to wait for another process to release the serial port")
+	efuseBurnResetBefore      = efuseBurnFlagSet.String("reset.before", esp32.ResetStrategyAuto, resetBeforeUsage)
+	efuseBurnResetAfter       = efuseBurnFlagSet.String("reset.after", resetAfterNoReset, resetAfterUsage)
+	efuseBurnVirtual          = efuseBurnFlagSet.String("efuse.virtual", "", "Use a virtual ESP32 with eFuses stored in this file instead of a serial port")
+	efuseBurnDryRun           = efuseBurnFlagSet.Bool("efuse.dryrun", false, "Only show the pending changes, don't burn anything")
+
+	emulatorFlagSet   = flag.NewFlagSet("emulator", flag.ExitOnError)
+	emulatorFlashSize = emulatorFlagSet.Uint("flash.size", 4*1024*1024, "Size of the emulated flash in bytes")
+	emulatorFlashFile = emulatorFlagSet.String("flash.file", "", "File with initial flash contents")
+	emulatorChip      = emulatorFlagSet.String("chip", esp32.ChipNameESP32, "Chip to emulate, ESP32 or ESP8266")
 
 	cliCommands = []*CliCommand{
 		&CliCommand{
@@ -66,17 +185,29 @@ var (
 				return versionCommand(*versionJson)
 			},
 		},
+		&CliCommand{
+			Name:        "ports",
+			Description: "List USB serial ports",
+			FlagSet:     portsFlagSet,
+			Callback: func(logger *log.Logger) error {
+				portsFlagSet.Parse(os.Args[2:])
+				return portsCommand(*portsJson)
+			},
+		},
 		&CliCommand{
 			Name:        "info",
 			Description: "Retrieve various information from chip",
 			FlagSet:     infoFlagSet,
 			Callback: func(logger *log.Logger) error {
 				infoFlagSet.Parse(os.Args[2:])
-				esp32, err := connectEsp32(*infoPort, uint32(*infoConnectBaudrate), uint32(*infoTransferBaudrate), *infoRetries, logger)
+				esp32, err := connectEsp32(*infoPort, uint32(*infoConnectBaudrate), uint32(*infoTransferBaudrate), *infoRetries, "", *infoResetBefore, *infoResetAfter, *infoLockWait, logger)
 				if err != nil {
 					return err
 				}
-				return infoCommand(*infoJson, esp32)
+				if err = infoCommand(*infoJson, esp32, logger); err != nil {
+					return err
+				}
+				return leaveEsp32(esp32, *infoResetAfter)
 			},
 		},
 		&CliCommand{
@@ -85,16 +216,36 @@ var (
 			FlagSet:     flashReadFlagSet,
 			Callback: func(logger *log.Logger) error {
 				flashReadFlagSet.Parse(os.Args[2:])
-				esp32, err := connectEsp32(*flashReadPort, uint32(*flashReadConnectBaudrate), uint32(*flashReadTransferBaudrate), *flashReadRetries, logger)
+				esp32, err := connectEsp32(*flashReadPort, uint32(*flashReadConnectBaudrate), uint32(*flashReadTransferBaudrate), *flashReadRetries, *flashReadStub, *flashReadResetBefore, *flashReadResetAfter, *flashReadLockWait, logger)
 				if err != nil {
 					return err
 				}
-				bytes, err := esp32.ReadFlash(uint32(*flashReadOffset), uint32(*flashReadSize))
-				if err != nil {
+				offset, size := uint32(*flashReadOffset), uint32(*flashReadSize)
+				if *flashReadPartitionName != "" {
+					partition, err := findPartition(esp32, *flashReadPartitionName)
+					if err != nil {
+						return err
+					}
+					if size > uint32(partition.Size) {
+						return fmt.Errorf("Cannot read %d bytes from partition '%s' of size %d", size, partition.Name, partition.Size)
+					}
+					if size == 0 {
+						size = uint32(partition.Size)
+					}
+					offset = uint32(partition.Offset)
+				}
+				output := os.Stdout
+				if *flashReadFile != "" {
+					output, err = os.Create(*flashReadFile)
+					if err != nil {
+						return err
+					}
+					defer output.Close()
+				}
+				if err = esp32.ReadFlashTo(offset, size, output); err != nil {
 					return err
 				}
-				os.Stdout.Write(bytes)
-				return nil
+				return leaveEsp32(esp32, *flashReadResetAfter)
 			},
 		},
 		&CliCommand{
@@ -103,21 +254,248 @@ var (
 			FlagSet:     flashWriteFlagSet,
 			Callback: func(logger *log.Logger) error {
 				flashWriteFlagSet.Parse(os.Args[2:])
-				contents, err := ioutil.ReadFile(*flashWriteFile)
+				targets := flashWriteFlagSet.Args()
+				if *flashWriteFile != "" {
+					target := strconv.FormatUint(uint64(*flashWriteOffset), 10)
+					if *flashWritePartitionName != "" {
+						target = *flashWritePartitionName
+					}
+					targets = append(targets, target+"="+*flashWriteFile)
+				}
+				if len(targets) == 0 {
+					return fmt.Errorf("Nothing to write, use -flash.file or offset=file arguments")
+				}
+				targetFiles, err := readFlashTargetFiles(targets)
+				if err != nil {
+					return err
+				}
+				esp32, err := connectEsp32(*flashWritePort, uint32(*flashWriteConnectBaudrate), uint32(*flashWriteTransferBaudrate), *flashWriteRetries, *flashWriteStub, *flashWriteResetBefore, *flashWriteResetAfter, *flashWriteLockWait, logger)
+				if err != nil {
+					return err
+				}
+				regions, err := resolveFlashRegions(esp32, targetFiles)
 				if err != nil {
 					return err
 				}
-				esp32, err := connectEsp32(*flashWritePort, uint32(*flashWriteConnectBaudrate), uint32(*flashWriteTransferBaudrate), *flashWriteRetries, logger)
+				err = esp32.PatchFlashParameters(regions, *flashWriteMode, *flashWriteFrequency, *flashWriteSize)
 				if err != nil {
 					return err
 				}
 
-				err = esp32.WriteFlash(uint32(*flashWriteOffset), contents, *flashWriteCompress)
+				err = esp32.WriteFlashRegions(regions, *flashWriteCompress, *flashWriteVerify, *flashWriteForce)
+				if err != nil {
+					return withForceHint(err)
+				}
+				logger.Print("Done")
+				return leaveEsp32(esp32, *flashWriteResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "eraseFlash",
+			Description: "Erase the entire flash",
+			FlagSet:     eraseFlashFlagSet,
+			Callback: func(logger *log.Logger) error {
+				eraseFlashFlagSet.Parse(os.Args[2:])
+				esp32, err := connectEsp32(*eraseFlashPort, uint32(*eraseFlashConnectBaudrate), uint32(*eraseFlashTransferBaudrate), *eraseFlashRetries, *eraseFlashStub, *eraseFlashResetBefore, *eraseFlashResetAfter, *eraseFlashLockWait, logger)
 				if err != nil {
-					panic(err)
+					return err
+				}
+				err = esp32.EraseFlash()
+				if err != nil {
+					return err
 				}
 				logger.Print("Done")
-				return nil
+				return leaveEsp32(esp32, *eraseFlashResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "eraseRegion",
+			Description: "Erase a region or partition of the flash",
+			FlagSet:     eraseRegionFlagSet,
+			Callback: func(logger *log.Logger) error {
+				eraseRegionFlagSet.Parse(os.Args[2:])
+				if *eraseRegionPartitionName != "" && (flagGiven(eraseRegionFlagSet, "flash.offset") || flagGiven(eraseRegionFlagSet, "flash.size")) {
+					return fmt.Errorf("Give either -flash.partition.name or -flash.offset and -flash.size, the partition determines both")
+				}
+				esp32, err := connectEsp32(*eraseRegionPort, uint32(*eraseRegionConnectBaudrate), uint32(*eraseRegionTransferBaudrate), *eraseRegionRetries, *eraseRegionStub, *eraseRegionResetBefore, *eraseRegionResetAfter, *eraseRegionLockWait, logger)
+				if err != nil {
+					return err
+				}
+				offset, size := uint32(*eraseRegionOffset), uint32(*eraseRegionSize)
+				if *eraseRegionPartitionName != "" {
+					partition, err := findPartition(esp32, *eraseRegionPartitionName)
+					if err != nil {
+						return err
+					}
+					offset, size = uint32(partition.Offset), uint32(partition.Size)
+				}
+				err = esp32.EraseRegion(offset, size)
+				if err != nil {
+					return err
+				}
+				logger.Print("Done")
+				return leaveEsp32(esp32, *eraseRegionResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "imageInfo",
+			Description: "Show information about an application or bootloader image",
+			FlagSet:     imageInfoFlagSet,
+			Callback: func(logger *log.Logger) error {
+				imageInfoFlagSet.Parse(os.Args[2:])
+				if *imageInfoFile != "" {
+					data, err := ioutil.ReadFile(*imageInfoFile)
+					if err != nil {
+						return err
+					}
+					img, err := image.ParseAny(data)
+					if err != nil {
+						return err
+					}
+					return imageInfoCommand(*imageInfoJson, NewImageInfo(*imageInfoFile, img))
+				}
+
+				esp32, err := connectEsp32(*imageInfoPort, uint32(*imageInfoConnectBaudrate), uint32(*imageInfoTransferBaudrate), *imageInfoRetries, *imageInfoStub, *imageInfoResetBefore, *imageInfoResetAfter, *imageInfoLockWait, logger)
+				if err != nil {
+					return err
+				}
+				if *imageInfoOffset >= flashSizeMax {
+					return fmt.Errorf("Offset %08X is beyond the end of flash", *imageInfoOffset)
+				}
+				offset, size := uint32(*imageInfoOffset), uint32(flashSizeMax-*imageInfoOffset)
+				source := fmt.Sprintf("flash at %08X", offset)
+				if *imageInfoPartitionName != "" {
+					partition, err := findPartition(esp32, *imageInfoPartitionName)
+					if err != nil {
+						return err
+					}
+					offset, size = uint32(partition.Offset), uint32(partition.Size)
+					source = fmt.Sprintf("partition '%s' at %08X", partition.Name, offset)
+				}
+				img, err := esp32.Chip().ReadImage(esp32.NewFlashReader(offset, size))
+				if err != nil {
+					return err
+				}
+				if err = imageInfoCommand(*imageInfoJson, NewImageInfo(source, img)); err != nil {
+					return err
+				}
+				return leaveEsp32(esp32, *imageInfoResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "regRead",
+			Description: "Read registers given by address or name, e.g. 0x3ff44004, GPIO_IN_REG or GPIO+0x3c",
+			FlagSet:     regReadFlagSet,
+			Callback: func(logger *log.Logger) error {
+				regReadFlagSet.Parse(os.Args[2:])
+				if *regReadList {
+					fmt.Println(strings.Join(esp32.RegisterNames(), "\n"))
+					return nil
+				}
+				rom, err := connectEsp32(*regReadPort, uint32(*regReadConnectBaudrate), uint32(*regReadTransferBaudrate), *regReadRetries, "", *regReadResetBefore, *regReadResetAfter, *regReadLockWait, logger)
+				if err != nil {
+					return err
+				}
+				if err = regReadCommand(rom, regReadFlagSet.Args()); err != nil {
+					return err
+				}
+				return leaveEsp32(rom, *regReadResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "regWrite",
+			Description: "Write registers given as register=value arguments, e.g. GPIO_OUT_W1TS_REG=0x20",
+			FlagSet:     regWriteFlagSet,
+			Callback: func(logger *log.Logger) error {
+				regWriteFlagSet.Parse(os.Args[2:])
+				if *regWriteMask > 0xFFFFFFFF {
+					return fmt.Errorf("Register mask %X exceeds 32 bits", *regWriteMask)
+				}
+				rom, err := connectEsp32(*regWritePort, uint32(*regWriteConnectBaudrate), uint32(*regWriteTransferBaudrate), *regWriteRetries, "", *regWriteResetBefore, *regWriteResetAfter, *regWriteLockWait, logger)
+				if err != nil {
+					return err
+				}
+				if err = regWriteCommand(rom, regWriteFlagSet.Args(), uint32(*regWriteMask), *regWriteDelay); err != nil {
+					return err
+				}
+				return leaveEsp32(rom, *regWriteResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "efuseSummary",
+			Description: "Read and decode all eFuses",
+			FlagSet:     efuseSummaryFlagSet,
+			Callback: func(logger *log.Logger) error {
+				efuseSummaryFlagSet.Parse(os.Args[2:])
+				var rom *esp32.ESP32ROM
+				var err error
+				if *efuseSummaryVirtual != "" {
+					rom, err = connectVirtualEsp32(*efuseSummaryVirtual, logger)
+				} else {
+					rom, err = connectEsp32(*efuseSummaryPort, uint32(*efuseSummaryConnectBaudrate), uint32(*efuseSummaryTransferBaudrate), *efuseSummaryRetries, "", *efuseSummaryResetBefore, *efuseSummaryResetAfter, *efuseSummaryLockWait, logger)
+				}
+				if err != nil {
+					return err
+				}
+				if err = efuseSummaryCommand(*efuseSummaryJson, rom); err != nil {
+					return err
+				}
+				return leaveEsp32(rom, *efuseSummaryResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "efuseBurn",
+			Description: "Burn eFuses given as FIELD=value arguments, e.g. CUSTOM_MAC=12:34:56:78:9a:bc",
+			FlagSet:     efuseBurnFlagSet,
+			Callback: func(logger *log.Logger) error {
+				efuseBurnFlagSet.Parse(os.Args[2:])
+				var rom *esp32.ESP32ROM
+				var err error
+				if *efuseBurnVirtual != "" {
+					rom, err = connectVirtualEsp32(*efuseBurnVirtual, logger)
+				} else {
+					rom, err = connectEsp32(*efuseBurnPort, uint32(*efuseBurnConnectBaudrate), uint32(*efuseBurnTransferBaudrate), *efuseBurnRetries, "", *efuseBurnResetBefore, *efuseBurnResetAfter, *efuseBurnLockWait, logger)
+				}
+				if err != nil {
+					return err
+				}
+				if err = efuseBurnCommand(rom, efuseBurnFlagSet.Args(), *efuseBurnDryRun, os.Stdin); err != nil {
+					return err
+				}
+				return leaveEsp32(rom, *efuseBurnResetAfter)
+			},
+		},
+		&CliCommand{
+			Name:        "emulator",
+			Description: "Emulate an ESP32 or ESP8266 in download mode on a pseudo terminal",
+			FlagSet:     emulatorFlagSet,
+			Callback: func(logger *log.Logger) error {
+				emulatorFlagSet.Parse(os.Args[2:])
+				var device *emulator.Device
+				switch strings.ToUpper(*emulatorChip) {
+				case esp32.ChipNameESP32:
+					device = emulator.NewDevice(int(*emulatorFlashSize), logger)
+				case esp32.ChipNameESP8266:
+					device = emulator.NewESP8266Device(int(*emulatorFlashSize), logger)
+				default:
+					return fmt.Errorf("Emulating a %s is not supported", *emulatorChip)
+				}
+				if *emulatorFlashFile != "" {
+					contents, err := ioutil.ReadFile(*emulatorFlashFile)
+					if err != nil {
+						return err
+					}
+					if len(contents) > len(device.Flash) {
+						return fmt.Errorf("Flash file is larger than the emulated flash")
+					}
+					copy(device.Flash, contents)
+				}
+				ptyPath, err := device.ServePty()
+				if err != nil {
+					return err
+				}
+				logger.Printf("Emulated %s is listening on %s", strings.ToUpper(*emulatorChip), ptyPath)
+				select {}
 			},
 		},
 	}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fluepke/esptool/common/serial"
+	"os"
+)
+
+func portsCommand(jsonOutput bool) error {
+	ports, err := serial.ListPorts()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		prettyJson, err := json.MarshalIndent(ports, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(prettyJson)
+		return err
+	}
+	if len(ports) == 0 {
+		fmt.Println("No USB serial ports found")
+		return nil
+	}
+	for _, port := range ports {
+		fmt.Println(port.String())
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/fluepke/esptool/esp32"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func regReadCommand(rom *esp32.ESP32ROM, registers []string) error {
+	if len(registers) == 0 {
+		return fmt.Errorf("No registers given, expected one or more addresses or names")
+	}
+	for _, register := range registers {
+		address, err := esp32.ParseRegister(rom.Chip(), register)
+		if err != nil {
+			return err
+		}
+		value, err := rom.ReadRegister(address)
+		if err != nil {
+			return fmt.Errorf("Could not read register %s: %v", register, err)
+		}
+		fmt.Printf("%s (%08X): %08X\n", esp32.RegisterName(rom.Chip(), address), address, binary.LittleEndian.Uint32(value[:]))
+	}
+	return nil
+}
+
+// regWriteCommand executes register=value arguments in the given order
+func regWriteCommand(rom *esp32.ESP32ROM, writes []string, mask uint32, delay time.Duration) error {
+	if len(writes) == 0 {
+		return fmt.Errorf("No registers given, expected one or more register=value arguments")
+	}
+	for _, write := range writes {
+		parts := strings.SplitN(write, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid argument '%s', expected register=value", write)
+		}
+		address, err := esp32.ParseRegister(rom.Chip(), parts[0])
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseUint(parts[1], 0, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid register value '%s': %v", parts[1], err)
+		}
+		err = rom.WriteRegister(address, uint32(value), mask, delay)
+		if err != nil {
+			return fmt.Errorf("Could not write register %s: %v", parts[0], err)
+		}
+		fmt.Printf("%s (%08X) <- %08X (mask %08X)\n", esp32.RegisterName(rom.Chip(), address), address, value, mask)
+	}
+	return nil
+}
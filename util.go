@@ -1,10 +1,20 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/fluepke/esptool/common/serial"
+	"github.com/fluepke/esptool/emulator"
 	"github.com/fluepke/esptool/esp32"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func bold(s string) string {
@@ -15,16 +25,260 @@ func underline(s string) string {
 	return fmt.Sprintf("\033[4m%s\033[0m", s)
 }
 
-func connectEsp32(portPath string, connectBaudrate uint32, transferBaudrate uint32, retries uint, logger *log.Logger) (*esp32.ESP32ROM, error) {
-	serialConfig := serial.NewConfig(portPath, connectBaudrate)
+const (
+	resetAfterHardReset = "hard-reset"
+	resetAfterSoftReset = "soft-reset"
+	resetAfterNoReset   = "no-reset"
+)
+
+// resetAfterActions are the values of -reset.after, see leaveEsp32
+var resetAfterActions = map[string]func(rom *esp32.ESP32ROM) error{
+	resetAfterHardReset: (*esp32.ESP32ROM).HardReset,
+	resetAfterSoftReset: (*esp32.ESP32ROM).SoftReset,
+	resetAfterNoReset:   func(rom *esp32.ESP32ROM) error { return nil },
+}
+
+func connectEsp32(portPath string, connectBaudrate uint32, transferBaudrate uint32, retries uint, stubPath string, resetBefore string, resetAfter string, lockWait time.Duration, logger *log.Logger) (*esp32.ESP32ROM, error) {
+	resetSequence, err := esp32.ParseResetStrategy(resetBefore)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := resetAfterActions[resetAfter]; !found {
+		return nil, fmt.Errorf("Unknown reset.after action '%s', expected %s, %s or %s", resetAfter, resetAfterHardReset, resetAfterSoftReset, resetAfterNoReset)
+	}
+	var rom *esp32.ESP32ROM
+	if portPath == "" {
+		rom, err = detectEsp32(connectBaudrate, retries, resetSequence, lockWait, logger)
+	} else {
+		rom, _, err = openEsp32(findPortInfo(portPath), connectBaudrate, retries, resetSequence, lockWait, logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stubPath != "" {
+		err = runStub(rom, stubPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to run flasher stub, the %s needs %s: %s", rom.Chip().Name(), rom.Chip().StubName(), err.Error())
+		}
+	}
+	return rom, rom.ChangeBaudrate(transferBaudrate)
+}
+
+// openEsp32 opens a serial port and connects to the chip behind it. The port is closed if
+// connecting fails.
+func openEsp32(portInfo *serial.PortInfo, connectBaudrate uint32, retries uint, resetSequence esp32.ResetSequence, lockWait time.Duration, logger *log.Logger) (*esp32.ESP32ROM, *serial.Port, error) {
+	serialConfig := serial.NewConfig(portInfo.Path, connectBaudrate)
+	serialConfig.LockTimeout = lockWait
 	serialPort, err := serial.OpenPort(serialConfig)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to open serial port: %s", err.Error())
+		return nil, nil, fmt.Errorf("Failed to open serial port: %s", err.Error())
+	}
+	rom := esp32.NewESP32ROM(serialPort, logger)
+	rom.ResetSequence = resetSequence
+	// the USB-Serial/JTAG controller can be told by its USB IDs, no need to try the classic reset
+	rom.USBJTAGSerial = portInfo.IsUSBJTAGSerial()
+	err = rom.Connect(retries)
+	if err != nil {
+		serialPort.Close()
+		return nil, nil, fmt.Errorf("Failed to connect: %s", err.Error())
+	}
+	return rom, serialPort, nil
+}
+
+// findPortInfo looks up the USB attributes of the port at path, which may also be a link
+// like /dev/serial/by-id/...
+func findPortInfo(path string) *serial.PortInfo {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return &serial.PortInfo{Path: path}
+	}
+	ports, err := serial.ListPorts()
+	if err != nil {
+		return &serial.PortInfo{Path: path}
+	}
+	for _, port := range ports {
+		if port.Path == resolved {
+			port.Path = path
+			return port
+		}
+	}
+	return &serial.PortInfo{Path: path}
+}
+
+// detectEsp32 probes all USB serial ports in parallel and connects to the chip answering SYNC.
+// If chips answer on several ports, none of them is picked.
+func detectEsp32(connectBaudrate uint32, retries uint, resetSequence esp32.ResetSequence, lockWait time.Duration, logger *log.Logger) (*esp32.ESP32ROM, error) {
+	ports, err := serial.ListPorts()
+	if err != nil {
+		return nil, fmt.Errorf("No -serial.port given and the ports can't be enumerated: %v", err)
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("No -serial.port given and no USB serial port found")
+	}
+	logger.Printf("No serial port given, probing %d ports", len(ports))
+
+	type probe struct {
+		portInfo   *serial.PortInfo
+		rom        *esp32.ESP32ROM
+		serialPort *serial.Port
+		err        error
+	}
+	probes := make(chan *probe, len(ports))
+	for _, portInfo := range ports {
+		go func(portInfo *serial.PortInfo) {
+			portLogger := log.New(logger.Writer(), logger.Prefix()+portInfo.Path+": ", logger.Flags())
+			rom, serialPort, err := openEsp32(portInfo, connectBaudrate, retries, resetSequence, lockWait, portLogger)
+			probes <- &probe{portInfo, rom, serialPort, err}
+		}(portInfo)
+	}
+
+	found := []*probe{}
+	for range ports {
+		result := <-probes
+		if result.err != nil {
+			logger.Printf("No chip on %s: %v", result.portInfo.Path, result.err)
+			continue
+		}
+		logger.Printf("Found an %s on %s", result.rom.Chip().Name(), result.portInfo.String())
+		found = append(found, result)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("No chip answered on any of the %d USB serial ports", len(ports))
+	case 1:
+		return found[0].rom, nil
+	}
+	// picking one at random could flash or burn the wrong board
+	descriptions := []string{}
+	for _, result := range found {
+		result.serialPort.Close()
+		descriptions = append(descriptions, fmt.Sprintf("%s on %s", result.rom.Chip().Name(), result.portInfo.Path))
+	}
+	sort.Strings(descriptions)
+	return nil, fmt.Errorf("Chips answered on %d ports, select one with -serial.port: %s", len(found), strings.Join(descriptions, ", "))
+}
+
+// withForceHint points out -flash.force if err is a region rejected by validation
+func withForceHint(err error) error {
+	var validationError *esp32.ValidationError
+	if errors.As(err, &validationError) {
+		return fmt.Errorf("%v (use -flash.force to skip validation)", err)
+	}
+	return err
+}
+
+// leaveEsp32 runs the -reset.after action once a command is done
+func leaveEsp32(rom *esp32.ESP32ROM, resetAfter string) error {
+	return resetAfterActions[resetAfter](rom)
+}
+
+// connectVirtualEsp32 connects to an emulated ESP32 whose eFuses are stored in efuseFile,
+// so eFuse commands can be tried without touching real hardware
+func connectVirtualEsp32(efuseFile string, logger *log.Logger) (*esp32.ESP32ROM, error) {
+	device := emulator.NewDevice(4*1024*1024, nil)
+	if _, err := os.Stat(efuseFile); err == nil {
+		if err = device.LoadEfuses(efuseFile); err != nil {
+			return nil, err
+		}
+	}
+	device.EfuseFile = efuseFile
+	rom := esp32.NewESP32ROM(device, logger)
+	err := rom.Connect(1)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to virtual ESP32: %s", err.Error())
+	}
+	return rom, nil
+}
+
+func runStub(rom *esp32.ESP32ROM, stubPath string) error {
+	stubFile, err := os.Open(stubPath)
+	if err != nil {
+		return err
+	}
+	defer stubFile.Close()
+	stub, err := esp32.LoadStub(stubFile)
+	if err != nil {
+		return err
 	}
-	esp32 := esp32.NewESP32ROM(serialPort, logger)
-	err = esp32.Connect(retries)
+	return rom.RunStub(stub)
+}
+
+func findPartition(rom *esp32.ESP32ROM, name string) (*esp32.Partition, error) {
+	partitionList, err := rom.ReadPartitionList()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to connect to ESP32: %s", err.Error())
+		return nil, err
+	}
+	return partitionList.FindByName(name)
+}
+
+// flashTargetFile is an offset=file or partition=file argument together with the file contents
+type flashTargetFile struct {
+	target   string
+	fileName string
+	contents []byte
+}
+
+func readFlashTargetFiles(arguments []string) ([]flashTargetFile, error) {
+	targetFiles := make([]flashTargetFile, 0, len(arguments))
+	for _, argument := range arguments {
+		parts := strings.SplitN(argument, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid argument '%s', expected offset=file or partition=file", argument)
+		}
+		contents, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		targetFiles = append(targetFiles, flashTargetFile{
+			target:   parts[0],
+			fileName: parts[1],
+			contents: contents,
+		})
+	}
+	return targetFiles, nil
+}
+
+// resolveFlashRegions turns target files into flash regions. Targets that are no number
+// are looked up in the partition table of the chip.
+func resolveFlashRegions(rom *esp32.ESP32ROM, targetFiles []flashTargetFile) ([]esp32.FlashRegion, error) {
+	var partitionList esp32.PartitionList
+	regions := make([]esp32.FlashRegion, 0, len(targetFiles))
+	for _, targetFile := range targetFiles {
+		region := esp32.FlashRegion{
+			Name: targetFile.fileName,
+			Data: targetFile.contents,
+		}
+		offset, err := strconv.ParseUint(targetFile.target, 0, 32)
+		if err == nil {
+			region.Offset = uint32(offset)
+			regions = append(regions, region)
+			continue
+		}
+
+		if partitionList == nil {
+			partitionList, err = rom.ReadPartitionList()
+			if err != nil {
+				return nil, err
+			}
+		}
+		partition, err := partitionList.FindByName(targetFile.target)
+		if err != nil {
+			return nil, err
+		}
+		if len(targetFile.contents) > partition.Size {
+			return nil, fmt.Errorf("%s has %d bytes, which does not fit into partition '%s' of size %d", targetFile.fileName, len(targetFile.contents), partition.Name, partition.Size)
+		}
+		region.Offset = uint32(partition.Offset)
+		regions = append(regions, region)
 	}
-	return esp32, esp32.ChangeBaudrate(transferBaudrate)
+	return regions, nil
+}
+
+// flagGiven returns true if the flag with the given name was set on the command line
+func flagGiven(flagSet *flag.FlagSet, name string) (given bool) {
+	flagSet.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	return
 }